@@ -1,28 +1,192 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-	"net/http"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/adolfooes/api_faker/config"              // Import config package for DB connection strings
+	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/api/authz"
+	"github.com/adolfooes/api_faker/internal/api/middleware"
 	"github.com/adolfooes/api_faker/internal/api/router" // Import the router
 	"github.com/adolfooes/api_faker/internal/db"         // Import the database package if needed
+	"github.com/adolfooes/api_faker/internal/logging"
+	"github.com/adolfooes/api_faker/internal/metrics"
+	"github.com/adolfooes/api_faker/internal/mockcache"
+	"github.com/adolfooes/api_faker/internal/server"
+	"github.com/adolfooes/api_faker/internal/tracing"
+	"github.com/adolfooes/api_faker/internal/version"
+	"github.com/adolfooes/api_faker/pkg/utils/mail"
 )
 
 func main() {
-	// Initialize the database connection (if you're using a database)
-	db.InitDB(config.GetDatabaseConnectionString())
+	// Exit with an error status once the deferred cleanups have run
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
 
-	// Run the migrations (if you're using a database)
-	db.RunMigrations(config.GetDatabaseConnectionString())
+	// api_faker config print shows the settings the server would run with
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "config" {
+		os.Exit(configCommand(args[1:]))
+	}
+
+	// api_faker healthcheck probes the readiness of a running server, for container health checks
+	if len(args) > 0 && args[0] == "healthcheck" {
+		os.Exit(healthcheckCommand(args[1:]))
+	}
+
+	// Load the settings from the configuration file, the environment and the flags
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Invalid configuration:\n", err)
+	}
+	config.Set(cfg)
+
+	// Write the logs as JSON, with the request ID of the entries logged while serving a request
+	logging.Setup()
+
+	// Export the traces of the requests, joining the traces of the callers
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		log.Fatal("Failed to set up tracing:", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Failed to flush the traces", "error", err)
+		}
+	}()
+
+	slog.Info("Starting api_faker", "version", version.Get())
+
+	// Initialize the database connection, waiting for the database to come up
+	if err := db.InitDB(config.GetDatabaseConnectionString()); err != nil {
+		log.Fatal("Failed to connect to the database:", err)
+	}
+
+	// Report the connection pool and journal sizes in the metrics
+	metrics.RegisterDB(db.GetDB())
+
+	// Bring the schema to the latest migration
+	if err := db.RunMigrations(config.GetDatabaseConnectionString()); err != nil {
+		log.Fatal("Failed to run the migrations:", err)
+	}
+
+	// Give the admin role to the configured bootstrap admin, if it already signed up
+	if err := authz.PromoteBootstrapAdmin(context.Background()); err != nil {
+		log.Println("Failed to promote bootstrap admin:", err)
+	}
+
+	// Drop the cached routing table of a project when its configuration changes
+	if err := mockcache.Start(config.GetDatabaseConnectionString()); err != nil {
+		log.Fatal("Failed to listen for mock configuration changes:", err)
+	}
+
+	// Configure the sender used for account emails
+	sender, err := mail.NewSender(config.GetMailDriver())
+	if err != nil {
+		log.Fatal("Failed to configure mail sender:", err)
+	}
+	mail.SetDefaultSender(sender)
 
 	// Initialize the router
 	router := router.InitializeRouter()
 
-	// Start the HTTP server
-	log.Println("Server is running on port 8080")
-	err := http.ListenAndServe(":8080", router)
+	// Every request gets a request ID and an access log entry, including those no route matches.
+	// Preflight requests are answered before routing, as the routes only accept their own methods
+	srv, err := server.New(middleware.RequestIDMiddleware(middleware.AccessLogMiddleware(middleware.CORSMiddleware(router))))
 	if err != nil {
-		log.Fatal("Server failed to start:", err)
+		log.Fatal("Failed to set up TLS:", err)
+	}
+
+	// Serve the metrics on their own listener, so they aren't public with the API
+	metricsSrv := server.NewMetrics()
+	if metricsSrv != nil {
+		if err := server.StartMetrics(metricsSrv); err != nil {
+			log.Fatal("Failed to serve the metrics:", err)
+		}
+	}
+
+	// Serve until SIGTERM or SIGINT, then let the requests in flight finish
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if err := server.Run(ctx, srv); err != nil {
+		slog.Error("Server failed", "error", err)
+		exitCode = 1
+	}
+
+	// The metrics are served until the API is stopped, so the shutdown can be watched
+	if metricsSrv != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to stop the metrics server", "error", err)
+		}
+		cancel()
+	}
+
+	// Release the database and flush the spans of the last requests once nothing is served anymore
+	if err := db.Close(); err != nil {
+		slog.Error("Failed to close the database", "error", err)
+	}
+}
+
+// configCommand runs api_faker config <subcommand> and returns the exit status
+func configCommand(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: api_faker config print [-config file] [flags]")
+		return 2
+	}
+
+	cfg, err := config.Load(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:")
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := config.Print(os.Stdout, cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// healthcheckCommand runs api_faker healthcheck and returns the exit status: 0 when the server running with
+// the same settings is ready, 1 otherwise
+func healthcheckCommand(args []string) int {
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:")
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	config.Set(cfg)
+
+	if err := server.Probe(context.Background(), "/readyz"); err != nil {
+		fmt.Fprintln(os.Stderr, "Not ready:", err)
+		return 1
 	}
+	return 0
 }
@@ -1,21 +1,450 @@
+// Package config holds the settings of the server. They are loaded once at startup from the defaults,
+// a YAML file, the environment and the command-line flags, in that order, and read through the getters.
 package config
 
 import (
-	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// GetDatabaseConnectionString returns the database connection string from an environment variable
-func GetDatabaseConnectionString() string {
+// Config is the whole configuration of the server. Each setting is named after its YAML path, e.g.
+// server.address, which is also its command-line flag. The env tag names its environment variable, the
+// secret tag keeps it out of config print.
+type Config struct {
+	App      AppConfig      `yaml:"app"`
+	Server   ServerConfig   `yaml:"server"`
+	TLS      TLSConfig      `yaml:"tls"`
+	Database DatabaseConfig `yaml:"database"`
+	JWT      JWTConfig      `yaml:"jwt"`
+	CORS     CORSConfig     `yaml:"cors"`
+	Log      LogConfig      `yaml:"log"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	Mock     MockConfig     `yaml:"mock"`
+	Login    LoginConfig    `yaml:"login"`
+	Mail     MailConfig     `yaml:"mail"`
+}
+
+// AppConfig describes the deployment of the server
+type AppConfig struct {
+	Env                 string `yaml:"env" env:"APP_ENV"`                                 // development or production, where internal error details are kept out of responses
+	BaseURL             string `yaml:"base_url" env:"APP_BASE_URL"`                       // Public URL of the API, used to build links sent by email
+	BootstrapAdminEmail string `yaml:"bootstrap_admin_email" env:"BOOTSTRAP_ADMIN_EMAIL"` // Account that is always given the admin role
+}
+
+// ServerConfig sets up the HTTP server
+type ServerConfig struct {
+	Address           string        `yaml:"address" env:"SERVER_ADDR"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"` // How long a client may take to send the headers of a request
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`               // How long a client may take to send a whole request, 0 for no limit
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`             // How long serving a request may take, 0 for no limit
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`               // How long a keep-alive connection may wait for the next request
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES"`
+	HTTP2             bool          `yaml:"http2" env:"SERVER_HTTP2"`                                    // Negotiate HTTP/2 over TLS
+	H2C               bool          `yaml:"h2c" env:"SERVER_H2C"`                                        // Serve HTTP/2 over cleartext connections too, without TLS
+	HTTP2MaxStreams   int           `yaml:"http2_max_concurrent_streams" env:"SERVER_HTTP2_MAX_STREAMS"` // Concurrent streams per HTTP/2 connection
+	ShutdownDelay     time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`                         // How long the server keeps serving while reporting itself unready on shutdown
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`                     // How long the server waits for the requests in flight on shutdown
+}
+
+// TLSConfig makes the server serve HTTPS, from the certificate files or from a certificate issued by
+// its own certificate authority (auto)
+type TLSConfig struct {
+	CertFile      string        `yaml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile       string        `yaml:"key_file" env:"TLS_KEY_FILE"`
+	Auto          bool          `yaml:"auto" env:"TLS_AUTO"`                       // Serve a certificate of the generated CA, which also issues the project certificates
+	CADir         string        `yaml:"ca_dir" env:"TLS_CA_DIR"`                   // Where the generated CA is kept, shared by the replicas
+	Hosts         []string      `yaml:"hosts" env:"TLS_HOSTS"`                     // Names and IPs of the certificate served in auto mode
+	ClientCAFile  string        `yaml:"client_ca_file" env:"TLS_CLIENT_CA_FILE"`   // Other CAs whose client certificates are accepted
+	ClientCertTTL time.Duration `yaml:"client_cert_ttl" env:"TLS_CLIENT_CERT_TTL"` // Validity of the project certificates
+}
+
+// DatabaseConfig sets up the connection to Postgres
+type DatabaseConfig struct {
+	URL             string        `yaml:"url" env:"FAKER_DATABASE_URL" secret:"url"`
+	MigrationsDir   string        `yaml:"migrations_dir" env:"DB_MIGRATIONS_DIR"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout" env:"DB_CONNECT_TIMEOUT"` // How long the server keeps retrying to reach the database at startup
+	QueryTimeout    time.Duration `yaml:"query_timeout" env:"DB_QUERY_TIMEOUT"`     // How long a query may run before it is cancelled
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`   // 0 for no limit
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`   // 0 for no limit
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"` // 0 for no limit
+}
+
+// JWTConfig sets up the tokens given at login
+type JWTConfig struct {
+	Secret string        `yaml:"secret" env:"JWT_SECRET_KEY" secret:"true"`
+	TTL    time.Duration `yaml:"ttl" env:"JWT_TTL"`
+}
+
+// CORSConfig lets browsers on other origins call the API. CORS is off when no origin is allowed.
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"` // Origins allowed to call the API, * for any
+	AllowedMethods   []string      `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"` // How long browsers may cache a preflight response
+}
+
+// LogConfig sets up the logs
+type LogConfig struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`   // debug, info, warn or error
+	Format string `yaml:"format" env:"LOG_FORMAT"` // json or text
+}
+
+// TracingConfig sets up the traces. The exporters read the standard OTEL_* variables too.
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER"` // otlp, stdout or none
+}
+
+// MetricsConfig sets up the Prometheus metrics, served on their own listener so they aren't public with the API
+type MetricsConfig struct {
+	Address string `yaml:"address" env:"METRICS_ADDR"`              // Where /metrics is served, empty to not serve it
+	Token   string `yaml:"token" env:"METRICS_TOKEN" secret:"true"` // Bearer token scrapers must send, when set
+}
+
+// MockConfig sets up the mock server
+type MockConfig struct {
+	Cache       bool `yaml:"cache" env:"MOCK_CACHE"`               // Keep the compiled route tables of the projects in memory
+	CacheNotify bool `yaml:"cache_notify" env:"MOCK_CACHE_NOTIFY"` // Share route table invalidations with the other replicas through LISTEN/NOTIFY
+}
 
-	connStr := os.Getenv("FAKER_DATABASE_URL")
+// LoginConfig throttles failed logins
+type LoginConfig struct {
+	MaxAttempts      int           `yaml:"max_attempts" env:"LOGIN_MAX_ATTEMPTS"`               // Failed logins per email before a lockout
+	MaxAttemptsPerIP int           `yaml:"max_attempts_per_ip" env:"LOGIN_MAX_ATTEMPTS_PER_IP"` // Failed logins per IP before a lockout
+	AttemptWindow    time.Duration `yaml:"attempt_window" env:"LOGIN_ATTEMPT_WINDOW"`           // After how long without failures the counters start over
+	LockoutBase      time.Duration `yaml:"lockout_base" env:"LOGIN_LOCKOUT_BASE"`               // First lockout, doubled on each further failure
+	LockoutMax       time.Duration `yaml:"lockout_max" env:"LOGIN_LOCKOUT_MAX"`
+}
 
-	if connStr == "" {
-		connStr = "postgres://postgres:dev123@db:5432/api_faker_dev?sslmode=disable" // Replace with your default values
+// MailConfig sets up the account emails
+type MailConfig struct {
+	Driver  string     `yaml:"driver" env:"MAIL_DRIVER"` // smtp, file or log
+	From    string     `yaml:"from" env:"MAIL_FROM"`
+	FileDir string     `yaml:"file_dir" env:"MAIL_FILE_DIR"` // Where the file driver writes emails
+	SMTP    SMTPConfig `yaml:"smtp"`
+}
+
+// SMTPConfig sets up the smtp mail driver
+type SMTPConfig struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     int    `yaml:"port" env:"SMTP_PORT"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+// Default returns the configuration used for the settings that aren't set anywhere
+func Default() Config {
+	return Config{
+		App: AppConfig{
+			Env:     "development",
+			BaseURL: "http://localhost:8080",
+		},
+		Server: ServerConfig{
+			Address:           ":8080",
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			HTTP2:             true,
+			HTTP2MaxStreams:   250,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		TLS: TLSConfig{
+			CADir:         "./tls",
+			Hosts:         []string{"localhost", "127.0.0.1"},
+			ClientCertTTL: 365 * 24 * time.Hour,
+		},
+		Database: DatabaseConfig{
+			MigrationsDir:   "/migrations",
+			ConnectTimeout:  1 * time.Minute,
+			QueryTimeout:    5 * time.Second,
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		JWT: JWTConfig{
+			TTL: 1 * time.Hour,
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "X-Request-ID"},
+			ExposedHeaders: []string{"X-Request-ID"},
+			MaxAge:         10 * time.Minute,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter: "none",
+		},
+		Metrics: MetricsConfig{
+			Address: ":9090",
+		},
+		Mock: MockConfig{
+			Cache: true,
+		},
+		Login: LoginConfig{
+			MaxAttempts:      5,
+			MaxAttemptsPerIP: 20,
+			AttemptWindow:    15 * time.Minute,
+			LockoutBase:      1 * time.Minute,
+			LockoutMax:       1 * time.Hour,
+		},
+		Mail: MailConfig{
+			Driver:  "log",
+			From:    "no-reply@api-faker.local",
+			FileDir: "./mail",
+			SMTP: SMTPConfig{
+				Port: 587,
+			},
+		},
 	}
+}
+
+var (
+	current     atomic.Pointer[Config]
+	defaultOnce sync.Once
+)
 
-	return connStr
+// Set makes cfg the configuration read by the getters
+func Set(cfg *Config) {
+	current.Store(cfg)
 }
 
+// Get returns the configuration of the server. Tools that don't call Set, like the benchmarks, get the
+// defaults overridden by the environment.
+func Get() *Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+
+	defaultOnce.Do(func() {
+		cfg := Default()
+		applyEnv(&cfg) // The variables that don't parse keep their default
+		current.CompareAndSwap(nil, &cfg)
+	})
+	return current.Load()
+}
+
+// GetDatabaseConnectionString returns the database connection string
+func GetDatabaseConnectionString() string {
+	return Get().Database.URL
+}
+
+// GetMigrationsDir returns the directory of the migration files
+func GetMigrationsDir() string {
+	return Get().Database.MigrationsDir
+}
+
+// GetJWTSecretKey returns the key signing the tokens given at login
 func GetJWTSecretKey() []byte {
-	return []byte(os.Getenv("JWT_SECRET_KEY"))
+	return []byte(Get().JWT.Secret)
+}
+
+// GetJWTTTL returns how long a token given at login is valid
+func GetJWTTTL() time.Duration {
+	return Get().JWT.TTL
+}
+
+// GetAppBaseURL returns the public URL of the API, used to build links sent by email
+func GetAppBaseURL() string {
+	return strings.TrimSuffix(Get().App.BaseURL, "/")
+}
+
+// GetMailDriver returns which mail sender to use: smtp, file or log
+func GetMailDriver() string {
+	return Get().Mail.Driver
+}
+
+// GetMailFrom returns the sender address of outgoing emails
+func GetMailFrom() string {
+	return Get().Mail.From
+}
+
+// GetMailFileDir returns the directory where the file mail driver writes emails
+func GetMailFileDir() string {
+	return Get().Mail.FileDir
+}
+
+// GetSMTPAddress returns the host:port of the SMTP server
+func GetSMTPAddress() string {
+	smtp := Get().Mail.SMTP
+	return smtp.Host + ":" + strconv.Itoa(smtp.Port)
+}
+
+// GetSMTPCredentials returns the username and password used to authenticate with the SMTP server
+func GetSMTPCredentials() (string, string) {
+	smtp := Get().Mail.SMTP
+	return smtp.Username, smtp.Password
+}
+
+// GetLoginMaxAttempts returns how many failed logins per email are allowed before a lockout
+func GetLoginMaxAttempts() int {
+	return Get().Login.MaxAttempts
+}
+
+// GetLoginMaxAttemptsPerIP returns how many failed logins per IP are allowed before a lockout
+func GetLoginMaxAttemptsPerIP() int {
+	return Get().Login.MaxAttemptsPerIP
+}
+
+// GetLoginAttemptWindow returns after how long without failures the counters start over
+func GetLoginAttemptWindow() time.Duration {
+	return Get().Login.AttemptWindow
+}
+
+// GetLoginLockoutBase returns the duration of the first lockout, doubled on each further failure
+func GetLoginLockoutBase() time.Duration {
+	return Get().Login.LockoutBase
+}
+
+// GetLoginLockoutMax returns the longest a lockout can last
+func GetLoginLockoutMax() time.Duration {
+	return Get().Login.LockoutMax
+}
+
+// GetBootstrapAdminEmail returns the email of the account that is always given the admin role
+func GetBootstrapAdminEmail() string {
+	return strings.ToLower(strings.TrimSpace(Get().App.BootstrapAdminEmail))
+}
+
+// GetDBQueryTimeout returns how long a database query may run before it is cancelled
+func GetDBQueryTimeout() time.Duration {
+	return Get().Database.QueryTimeout
+}
+
+// GetDBConnectTimeout returns how long the server keeps retrying to reach the database at startup
+func GetDBConnectTimeout() time.Duration {
+	return Get().Database.ConnectTimeout
+}
+
+// GetDBMaxOpenConns returns how many connections the pool may open to the database, 0 for no limit
+func GetDBMaxOpenConns() int {
+	return Get().Database.MaxOpenConns
+}
+
+// GetDBMaxIdleConns returns how many idle connections the pool keeps open for the next queries
+func GetDBMaxIdleConns() int {
+	return Get().Database.MaxIdleConns
+}
+
+// GetDBConnMaxLifetime returns how long a connection is reused before it is closed, 0 for no limit
+func GetDBConnMaxLifetime() time.Duration {
+	return Get().Database.ConnMaxLifetime
+}
+
+// GetDBConnMaxIdleTime returns how long a connection may stay idle before it is closed, 0 for no limit
+func GetDBConnMaxIdleTime() time.Duration {
+	return Get().Database.ConnMaxIdleTime
+}
+
+// GetMetrics returns where the metrics are served and the token required to scrape them
+func GetMetrics() MetricsConfig {
+	return Get().Metrics
+}
+
+// GetMockCacheEnabled returns whether the mock handler keeps the compiled route tables of the projects in memory
+func GetMockCacheEnabled() bool {
+	return Get().Mock.Cache
+}
+
+// GetMockCacheNotify returns whether route table invalidations are shared with the other replicas through Postgres LISTEN/NOTIFY
+func GetMockCacheNotify() bool {
+	return Get().Mock.CacheNotify
+}
+
+// GetLogLevel returns the lowest level logged: debug, info, warn or error
+func GetLogLevel() string {
+	return strings.ToLower(Get().Log.Level)
+}
+
+// GetLogFormat returns how log entries are written: json or text
+func GetLogFormat() string {
+	return strings.ToLower(Get().Log.Format)
+}
+
+// GetAppEnv returns the environment the server runs in, e.g. development or production
+func GetAppEnv() string {
+	return strings.ToLower(Get().App.Env)
+}
+
+// IsProduction reports whether the server runs in production, where internal error details are kept out of responses
+func IsProduction() bool {
+	return GetAppEnv() == "production"
+}
+
+// GetTracesExporter returns where traces are exported: otlp, stdout or none
+func GetTracesExporter() string {
+	return strings.ToLower(Get().Tracing.Exporter)
+}
+
+// GetServerAddress returns the address the HTTP server listens on
+func GetServerAddress() string {
+	return Get().Server.Address
+}
+
+// GetServerReadHeaderTimeout returns how long a client may take to send the headers of a request
+func GetServerReadHeaderTimeout() time.Duration {
+	return Get().Server.ReadHeaderTimeout
+}
+
+// GetServerReadTimeout returns how long a client may take to send a whole request, 0 for no limit
+func GetServerReadTimeout() time.Duration {
+	return Get().Server.ReadTimeout
+}
+
+// GetServerWriteTimeout returns how long serving a request may take, from the end of its headers to the end of the response, 0 for no limit
+func GetServerWriteTimeout() time.Duration {
+	return Get().Server.WriteTimeout
+}
+
+// GetServerIdleTimeout returns how long a keep-alive connection may wait for the next request
+func GetServerIdleTimeout() time.Duration {
+	return Get().Server.IdleTimeout
+}
+
+// GetServerMaxHeaderBytes returns the largest size of the headers of a request
+func GetServerMaxHeaderBytes() int {
+	return Get().Server.MaxHeaderBytes
+}
+
+// GetServerHTTP2 returns whether HTTP/2 is negotiated over TLS, and served over cleartext connections (h2c)
+func GetServerHTTP2() (bool, bool) {
+	server := Get().Server
+	return server.HTTP2, server.H2C
+}
+
+// GetServerHTTP2MaxStreams returns how many concurrent streams an HTTP/2 connection may open
+func GetServerHTTP2MaxStreams() int {
+	return Get().Server.HTTP2MaxStreams
+}
+
+// GetShutdownDelay returns how long the server keeps serving after a termination signal while reporting itself unready,
+// so load balancers stop sending it requests before it stops accepting them
+func GetShutdownDelay() time.Duration {
+	return Get().Server.ShutdownDelay
+}
+
+// GetShutdownTimeout returns how long the server waits for the requests in flight to finish when shutting down
+func GetShutdownTimeout() time.Duration {
+	return Get().Server.ShutdownTimeout
+}
+
+// GetTLS returns how the server serves HTTPS and verifies client certificates
+func GetTLS() TLSConfig {
+	return Get().TLS
+}
+
+// GetCORS returns which cross-origin requests browsers are allowed to make
+func GetCORS() CORSConfig {
+	return Get().CORS
 }
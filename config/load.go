@@ -0,0 +1,212 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setting is a single value of Config
+type setting struct {
+	path   string        // YAML path, also the name of the flag, e.g. server.address
+	env    string        // Environment variable, if any
+	secret string        // true to mask the value when printed, url to mask the password of a URL
+	value  reflect.Value // The field, settable
+}
+
+// settings returns every value of cfg, in declaration order
+func settings(cfg *Config) []setting {
+	var out []setting
+
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			path := prefix + field.Tag.Get("yaml")
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), path+".")
+				continue
+			}
+			out = append(out, setting{path: path, env: field.Tag.Get("env"), secret: field.Tag.Get("secret"), value: v.Field(i)})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+
+	return out
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// parseValue parses s into v, according to its type. Lists are comma separated.
+func parseValue(v reflect.Value, s string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, e.g. 30s or 5m", s)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q, e.g. true or false", s)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// formatValue returns v the way parseValue reads it
+func formatValue(v reflect.Value) string {
+	switch {
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String()
+	case v.Kind() == reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// Load returns the configuration of the server: the defaults, overridden by the YAML file given with
+// -config (or CONFIG_FILE), then by the environment variables, then by the command-line flags in args.
+// The result is validated.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	all := settings(&cfg)
+
+	// The flags are parsed first to find the configuration file, and applied last
+	flags := flag.NewFlagSet("api_faker", flag.ContinueOnError)
+	file := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration `file` (env CONFIG_FILE)")
+	values := make([]*flagValue, len(all))
+	for i, s := range all {
+		values[i] = &flagValue{target: s.value}
+		usage := "see the configuration file"
+		if s.env != "" {
+			usage = "env " + s.env
+		}
+		flags.Var(values[i], s.path, usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	if *file != "" {
+		if err := loadFile(&cfg, *file); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	for _, value := range values {
+		if value.parsed.IsValid() {
+			value.target.Set(value.parsed)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// loadFile overrides cfg with the settings of a YAML file. Unknown settings are rejected, so typos don't
+// go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading the configuration file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error parsing the configuration file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides cfg with the environment variables that are set and not empty. The variables that
+// don't parse are reported together, and leave their setting unchanged.
+func applyEnv(cfg *Config) error {
+	var errs []error
+	for _, s := range settings(cfg) {
+		if s.env == "" {
+			continue
+		}
+		raw := os.Getenv(s.env)
+		if raw == "" {
+			continue
+		}
+
+		parsed := reflect.New(s.value.Type()).Elem()
+		if err := parseValue(parsed, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			continue
+		}
+		s.value.Set(parsed)
+	}
+	return errors.Join(errs...)
+}
+
+// flagValue is the command-line flag of a setting. The value is parsed when the flag is, and set once
+// the file and the environment have been applied.
+type flagValue struct {
+	target reflect.Value
+	parsed reflect.Value
+}
+
+func (f *flagValue) String() string {
+	// The flag package calls String on a zero flagValue to print the defaults
+	if f == nil || !f.target.IsValid() {
+		return ""
+	}
+	return formatValue(f.target)
+}
+
+func (f *flagValue) Set(s string) error {
+	parsed := reflect.New(f.target.Type()).Elem()
+	if err := parseValue(parsed, s); err != nil {
+		return err
+	}
+	f.parsed = parsed
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be turned on without a value, e.g. -mock.cache_notify
+func (f *flagValue) IsBoolFlag() bool {
+	return f.target.IsValid() && f.target.Kind() == reflect.Bool
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"io"
+	"net/url"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maskedValue replaces the secrets in the printed configuration
+const maskedValue = "********"
+
+// Print writes cfg as YAML, with the environment variable of each setting as a comment. Secrets are
+// masked, so the output can be shared.
+func Print(w io.Writer, cfg *Config) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(printNode(reflect.ValueOf(cfg).Elem())); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// printNode returns the YAML mapping of the struct v
+func printNode(v reflect.Value) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: field.Tag.Get("yaml")}
+
+		var value *yaml.Node
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			value = printNode(v.Field(i))
+		case field.Type.Kind() == reflect.Slice:
+			value = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+			for _, item := range v.Field(i).Interface().([]string) {
+				value.Content = append(value.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+			}
+		default:
+			value = &yaml.Node{Kind: yaml.ScalarNode, Tag: scalarTag(v.Field(i)), Value: maskSecret(field.Tag.Get("secret"), formatValue(v.Field(i)))}
+		}
+		if env := field.Tag.Get("env"); env != "" {
+			value.LineComment = env
+		}
+
+		node.Content = append(node.Content, key, value)
+	}
+
+	return node
+}
+
+// scalarTag returns the YAML tag of v, so strings like "true" or "8080" are quoted
+func scalarTag(v reflect.Value) string {
+	switch {
+	case v.Type() == durationType, v.Kind() == reflect.String:
+		return "!!str"
+	case v.Kind() == reflect.Bool:
+		return "!!bool"
+	default:
+		return "!!int"
+	}
+}
+
+// maskSecret masks value according to the secret tag of its setting: entirely, or only the password of a URL
+func maskSecret(secret, value string) string {
+	if secret == "" || value == "" {
+		return value
+	}
+	if secret == "url" {
+		if u, err := url.Parse(value); err == nil {
+			return u.Redacted()
+		}
+	}
+	return maskedValue
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// minProductionSecretLength is the shortest JWT secret accepted in production, the size of an HS256 key
+const minProductionSecretLength = 32
+
+// Validate returns every invalid setting of cfg, joined
+func (cfg *Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	oneOf := func(path, value string, allowed ...string) {
+		if !slices.Contains(allowed, strings.ToLower(value)) {
+			invalid("%s must be one of %s, got %q", path, strings.Join(allowed, ", "), value)
+		}
+	}
+
+	if baseURL, err := url.Parse(cfg.App.BaseURL); err != nil || baseURL.Scheme == "" || baseURL.Host == "" {
+		invalid("app.base_url must be an absolute URL, got %q", cfg.App.BaseURL)
+	}
+
+	if cfg.Server.Address == "" {
+		invalid("server.address is required")
+	}
+	if cfg.Server.MaxHeaderBytes <= 0 {
+		invalid("server.max_header_bytes must be positive")
+	}
+	if cfg.Server.HTTP2MaxStreams <= 0 {
+		invalid("server.http2_max_concurrent_streams must be positive")
+	}
+	if cfg.Server.H2C && (cfg.TLS.Auto || cfg.TLS.CertFile != "") {
+		invalid("server.h2c only applies to cleartext connections, it can't be used with TLS")
+	}
+
+	if cfg.Metrics.Address != "" && cfg.Metrics.Address == cfg.Server.Address {
+		invalid("metrics.address must differ from server.address, the metrics aren't served with the API")
+	}
+
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		invalid("tls.cert_file and tls.key_file must be set together")
+	}
+	if cfg.TLS.Auto && cfg.TLS.CertFile != "" {
+		invalid("tls.auto can't be used with tls.cert_file, the certificate is issued by the generated CA")
+	}
+	if cfg.TLS.Auto && (cfg.TLS.CADir == "" || len(cfg.TLS.Hosts) == 0) {
+		invalid("tls.auto requires tls.ca_dir and tls.hosts")
+	}
+	if cfg.TLS.ClientCAFile != "" && !cfg.TLS.Auto && cfg.TLS.CertFile == "" {
+		invalid("tls.client_ca_file requires HTTPS, with tls.cert_file or tls.auto")
+	}
+
+	if cfg.Database.URL == "" {
+		invalid("database.url is required (FAKER_DATABASE_URL)")
+	} else if dbURL, err := url.Parse(cfg.Database.URL); err != nil || (dbURL.Scheme != "postgres" && dbURL.Scheme != "postgresql") {
+		invalid("database.url must be a postgres:// URL")
+	}
+	if cfg.Database.MigrationsDir == "" {
+		invalid("database.migrations_dir is required")
+	}
+	if cfg.Database.MaxOpenConns < 0 || cfg.Database.MaxIdleConns < 0 {
+		invalid("database.max_open_conns and database.max_idle_conns can't be negative")
+	}
+
+	if cfg.JWT.Secret == "" {
+		invalid("jwt.secret is required (JWT_SECRET_KEY)")
+	} else if strings.EqualFold(cfg.App.Env, "production") && len(cfg.JWT.Secret) < minProductionSecretLength {
+		invalid("jwt.secret must be at least %d bytes long in production", minProductionSecretLength)
+	}
+	if cfg.JWT.TTL <= 0 {
+		invalid("jwt.ttl must be positive")
+	}
+
+	if cfg.CORS.AllowCredentials && slices.Contains(cfg.CORS.AllowedOrigins, "*") {
+		invalid("cors.allow_credentials can't be used with the * origin, list the allowed origins")
+	}
+
+	oneOf("log.level", cfg.Log.Level, "debug", "info", "warn", "error")
+	oneOf("log.format", cfg.Log.Format, "json", "text")
+	oneOf("tracing.exporter", cfg.Tracing.Exporter, "otlp", "stdout", "none")
+	oneOf("mail.driver", cfg.Mail.Driver, "smtp", "file", "log")
+
+	if strings.EqualFold(cfg.Mail.Driver, "smtp") && cfg.Mail.SMTP.Host == "" {
+		invalid("mail.smtp.host is required by the smtp mail driver")
+	}
+
+	// Negative durations would turn timeouts and lockouts off, or make them expire at once
+	for _, s := range settings(cfg) {
+		if s.value.Type() == durationType && s.value.Int() < 0 {
+			invalid("%s can't be negative", s.path)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,68 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/repository"
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+)
+
+// Account roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// AccountID returns the account ID injected in the request context by the JWT middleware
+func AccountID(r *http.Request) (int64, error) {
+	accountIDStr, ok := r.Context().Value(config.JWTAccountIDKey).(string)
+	if !ok {
+		return 0, fmt.Errorf("account ID not found")
+	}
+
+	accountID, err := strconv.ParseInt(accountIDStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid account ID format")
+	}
+
+	return accountID, nil
+}
+
+// IsAdmin reports whether the account is an active admin
+func IsAdmin(ctx context.Context, accountID int64) (bool, error) {
+	account, err := repository.Default().GetAccount(ctx, accountID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, fmt.Errorf("no account found with id %d: %w", accountID, err)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return account.CanSignIn() && account.Role == RoleAdmin, nil
+}
+
+// CanManageAccount reports whether the actor may read or change the target account:
+// users can only manage themselves, admins can manage everyone
+func CanManageAccount(ctx context.Context, actorID int64, targetID int64) (bool, error) {
+	if actorID == targetID {
+		return true, nil
+	}
+	return IsAdmin(ctx, actorID)
+}
+
+// PromoteBootstrapAdmin gives the admin role to the account configured as bootstrap admin, if any.
+// The account must have verified the email, so nobody can claim the role by taking the address first.
+func PromoteBootstrapAdmin(ctx context.Context) error {
+	email := config.GetBootstrapAdminEmail()
+	if email == "" {
+		return nil
+	}
+
+	_, _, err := crud.Raw(ctx, "UPDATE account SET role = $1 WHERE email = $2 AND email_verified_at IS NOT NULL", RoleAdmin, email)
+	return err
+}
@@ -0,0 +1,54 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+)
+
+// accessibleProjects selects the projects an account owns or is an active member of
+const accessibleProjects = `SELECT id FROM project WHERE owner_id = ?
+	UNION SELECT project_id FROM project_users WHERE account_id = ? AND is_active AND removed_at IS NULL`
+
+// projectScopes maps each tenant-scoped table to the condition that limits its rows to a set of projects
+var projectScopes = map[string]string{
+	"project":    "id IN (%s)",
+	"url_config": "project_id IN (%s)",
+	"url_http_status": `url_id IN (SELECT uc.id FROM url_config uc
+		WHERE uc.project_id IN (%s))`,
+	"response_model": `url_http_status_id IN (SELECT s.id FROM url_http_status s
+		JOIN url_config uc ON uc.id = s.url_id
+		WHERE uc.project_id IN (%s))`,
+}
+
+// Scope returns the conditions that limit the rows of a table to the projects the account owns or is a member of.
+// Admins are not limited. Tables without a known scope are refused, so a missing scope can't leak other tenants' rows.
+func Scope(ctx context.Context, accountID int64, table string) ([]crud.Condition, error) {
+	isAdmin, err := IsAdmin(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if isAdmin {
+		return nil, nil
+	}
+
+	scope, ok := projectScopes[table]
+	if !ok {
+		return nil, fmt.Errorf("table %s has no tenant scope", table)
+	}
+
+	return []crud.Condition{{
+		Clause: fmt.Sprintf(scope, accessibleProjects),
+		Args:   []interface{}{accountID, accountID},
+	}}, nil
+}
+
+// ReadScoped retrieves a record of a tenant-scoped table if the account can see it
+func ReadScoped(ctx context.Context, accountID int64, table string, id int64) (crud.Row, error) {
+	conditions, err := Scope(ctx, accountID, table)
+	if err != nil {
+		return nil, err
+	}
+	return crud.ReadScoped(ctx, table, id, conditions...)
+}
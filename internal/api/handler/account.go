@@ -1,16 +1,22 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"regexp"
-	"strconv"
+	"strings"
+	"time"
 	"unicode"
 
+	"github.com/adolfooes/api_faker/internal/api/authz"
+	"github.com/adolfooes/api_faker/internal/mockcache"
+	"github.com/adolfooes/api_faker/internal/repository"
 	"github.com/adolfooes/api_faker/pkg/utils/crud"
 	"github.com/adolfooes/api_faker/pkg/utils/response"
-	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -21,6 +27,11 @@ type Account struct {
 	Password string `json:"password"`
 }
 
+// AccountRoleRequest carries the new role of an account
+type AccountRoleRequest struct {
+	Role string `json:"role"`
+}
+
 // hashPassword hashes the given password using bcrypt
 func hashPassword(password string) (string, error) {
 	// Generate hashed password with bcrypt, the cost parameter 14 is usually a good default
@@ -31,11 +42,10 @@ func hashPassword(password string) (string, error) {
 	return string(hashedPassword), nil
 }
 
-func validateEmail(email string) error {
-	emailRegex := `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
-	re := regexp.MustCompile(emailRegex)
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 
-	if !re.MatchString(email) {
+func validateEmail(email string) error {
+	if !emailRegex.MatchString(email) {
 		return fmt.Errorf("invalid email format")
 	}
 
@@ -78,9 +88,9 @@ func validateRequiredFields(account Account) error {
 	return nil
 }
 
-func checkDuplicateEmail(email string) (bool, error) {
+func checkDuplicateEmail(ctx context.Context, email string) (bool, error) {
 	filters := map[string]interface{}{"email": email}
-	accounts, err := crud.List("account", filters)
+	accounts, err := crud.List(ctx, "account", filters)
 	if err != nil {
 		return false, err
 	}
@@ -101,6 +111,9 @@ func CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Emails are stored lower-cased, the same way login looks them up
+	account.Email = strings.ToLower(strings.TrimSpace(account.Email))
+
 	if err := validateRequiredFields(account); err != nil {
 		response.SendResponse(w, http.StatusBadRequest, "Missing required fields", err.Error(), nil, false)
 		return
@@ -116,9 +129,9 @@ func CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	exists, err := checkDuplicateEmail(account.Email)
+	exists, err := checkDuplicateEmail(r.Context(), account.Email)
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Error checking duplicate email", err.Error(), nil, false)
+		sendServerError(w, "Error checking duplicate email", err)
 		return
 	}
 	if exists {
@@ -129,67 +142,91 @@ func CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
 	// Hash the password before storing it
 	hashedPassword, err := hashPassword(account.Password)
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to hash password", err.Error(), nil, false)
+		sendServerError(w, "Failed to hash password", err)
 		return
 	}
 	account.Password = hashedPassword
 
-	// Insert the new account into the database using the crud package
-	columns := []string{"email", "password"}
-	values := []interface{}{account.Email, account.Password}
-	createdAccount, err := crud.Create("account", columns, values) // Fetching the created account object
+	// Insert the new account into the database using the crud package, inactive until the email is verified.
+	// The bootstrap admin only gets its role once the email is verified, see VerifyEmailHandler
+	columns := []string{"email", "password", "is_active", "role"}
+	values := []interface{}{account.Email, account.Password, false, authz.RoleUser}
+	createdAccount, err := crud.Create(r.Context(), "account", columns, values) // Fetching the created account object
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to create account", err.Error(), nil, false)
+		sendServerError(w, "Failed to create account", err)
 		return
 	}
 
+	// A failed email is not fatal, the user can ask for a new one
+	if err := sendVerificationEmail(r.Context(), createdAccount.Int64("id"), account.Email); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to send verification email", "account_id", createdAccount.Int64("id"), "error", err)
+	}
+
 	// Remove password from the response
 	if createdAccount != nil {
 		createdAccount["password"] = nil
 	}
 
-	response.SendResponse(w, http.StatusCreated, "Account created successfully", "", createdAccount, false)
+	response.SendResponse(w, http.StatusCreated, "Account created successfully, check your email to verify it", "", createdAccount, false)
+}
+
+var accountListSpec = listSpec{
+	table:       "account",
+	name:        "accounts",
+	filterable:  []string{"email", "role", "is_active"},
+	sortable:    []string{"id", "email", "created_at", "last_login"},
+	defaultSort: []crud.SortField{{Column: "id"}},
+	// Remove password from the response
+	format: func(row crud.Row) crud.Row {
+		row["password"] = nil
+		return row
+	},
 }
 
 // GetAllAccountsHandler retrieves all accounts from the database
 func GetAllAccountsHandler(w http.ResponseWriter, r *http.Request) {
-	filters := map[string]interface{}{} // No filters, get all accounts
-	results, err := crud.List("account", filters)
+	sendList(w, r, accountListSpec, nil, "Accounts retrieved successfully")
+}
+
+// authorizeAccountAccess checks that the caller may manage the account in the path.
+// It sends the error response itself and returns false when the request must stop.
+func authorizeAccountAccess(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := getIDFromVars(r, "id")
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to retrieve accounts", err.Error(), nil, false)
-		return
+		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
+		return 0, false
 	}
 
-	// Remove password from the response
-	for _, result := range results {
-		result["password"] = nil
+	actorID, err := authz.AccountID(r)
+	if err != nil {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Account ID not found", err.Error(), nil, false)
+		return 0, false
 	}
 
-	response.SendResponse(w, http.StatusOK, "Accounts retrieved successfully", "", results, false)
+	allowed, err := authz.CanManageAccount(r.Context(), actorID, id)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		sendServerError(w, "Failed to check account access", err)
+		return 0, false
+	}
+	if !allowed {
+		response.SendResponse(w, http.StatusForbidden, "Forbidden: you can only manage your own account", "", nil, false)
+		return 0, false
+	}
+
+	return id, true
 }
 
 // GetAccountHandler retrieves a single account by ID from the database
 func GetAccountHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the {id} from the URL path using Gorilla Mux's Vars
-	vars := mux.Vars(r)
-	idStr, ok := vars["id"]
-	if !ok || idStr == "" {
-		// If the id is missing in the path, return a bad request
-		response.SendResponse(w, http.StatusBadRequest, "ID is missing in the request", "", nil, false)
-		return
-	}
-
-	// Convert the id from string to int
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
+	id, ok := authorizeAccountAccess(w, r)
+	if !ok {
 		return
 	}
 
 	// Fetch the account from the database using the crud.Read function
-	result, err := crud.Read("account", id)
+	result, err := crud.Read(r.Context(), "account", id)
 	if err != nil {
-		response.SendResponse(w, http.StatusNotFound, "Failed to retrieve account", err.Error(), nil, false)
+		sendLookupError(w, "Failed to retrieve account", err)
 		return
 	}
 
@@ -203,6 +240,11 @@ func GetAccountHandler(w http.ResponseWriter, r *http.Request) {
 
 // UpdateAccountHandler handles updating an existing account
 func UpdateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := authorizeAccountAccess(w, r)
+	if !ok {
+		return
+	}
+
 	var account Account
 	err := json.NewDecoder(r.Body).Decode(&account)
 	if err != nil {
@@ -210,25 +252,60 @@ func UpdateAccountHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only the provided fields are updated
+	updates := map[string]interface{}{}
+
+	// A new email stays pending until it is verified, the account keeps its current email meanwhile
+	var pendingEmail string
+	if account.Email != "" {
+		account.Email = strings.ToLower(strings.TrimSpace(account.Email))
+		if err := validateEmail(account.Email); err != nil {
+			response.SendResponse(w, http.StatusBadRequest, "Invalid email", err.Error(), nil, false)
+			return
+		}
+
+		current, err := crud.Read(r.Context(), "account", id)
+		if err != nil {
+			sendLookupError(w, "Failed to retrieve account", err)
+			return
+		}
+		if account.Email != current.String("email") {
+			exists, err := checkDuplicateEmail(r.Context(), account.Email)
+			if err != nil {
+				sendServerError(w, "Error checking duplicate email", err)
+				return
+			}
+			if exists {
+				response.SendResponse(w, http.StatusConflict, "Account with this email already exists", "", nil, false)
+				return
+			}
+			pendingEmail = account.Email
+			updates["pending_email"] = pendingEmail
+		}
+	}
+
 	// If the password is being updated, hash the new password
 	if account.Password != "" {
+		if err := validatePassword(account.Password); err != nil {
+			response.SendResponse(w, http.StatusBadRequest, "Weak password", err.Error(), nil, false)
+			return
+		}
 		hashedPassword, err := hashPassword(account.Password)
 		if err != nil {
-			response.SendResponse(w, http.StatusInternalServerError, "Failed to hash password", err.Error(), nil, false)
+			sendServerError(w, "Failed to hash password", err)
 			return
 		}
-		account.Password = hashedPassword
+		updates["password"] = hashedPassword
 	}
 
-	// Update the account in the database using the crud package
-	updates := map[string]interface{}{
-		"email":    account.Email,
-		"password": account.Password,
+	if len(updates) == 0 {
+		response.SendResponse(w, http.StatusBadRequest, "Nothing to update", "", nil, false)
+		return
 	}
 
-	updatedAccount, err := crud.Update("account", account.ID, updates) // Fetching the updated account object
+	updatedAccount, err := crud.Update(r.Context(), "account", id, updates) // Fetching the updated account object
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to update account", err.Error(), nil, false)
+		sendServerError(w, "Failed to update account", err)
 		return
 	}
 
@@ -237,23 +314,112 @@ func UpdateAccountHandler(w http.ResponseWriter, r *http.Request) {
 		updatedAccount["password"] = nil
 	}
 
+	if pendingEmail != "" {
+		// A failed email is not fatal, the user can change the email again
+		if err := sendEmailChangeEmail(r.Context(), id, pendingEmail); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to send email change confirmation", "account_id", id, "error", err)
+		}
+		response.SendResponse(w, http.StatusOK, "Account updated successfully, check the new email to confirm it", "", updatedAccount, false)
+		return
+	}
+
 	response.SendResponse(w, http.StatusOK, "Account updated successfully", "", updatedAccount, false)
 }
 
 // DeleteAccountHandler handles deleting an account
 func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, ok := authorizeAccountAccess(w, r)
+	if !ok {
+		return
+	}
+
+	// The projects of the account are deleted with it, so their cached routes are invalidated after the commit.
+	// The account is locked first so no project can be created for it in between.
+	err := crud.WithTx(r.Context(), func(tx *crud.Tx) error {
+		if _, _, err := tx.Raw("SELECT id FROM account WHERE id = $1 FOR UPDATE", id); err != nil {
+			return err
+		}
+		projects, _, err := tx.Raw("SELECT id FROM project WHERE owner_id = $1", id)
+		if err != nil {
+			return err
+		}
+		for _, project := range projects {
+			tx.ProjectChanged(project.Int64("id"))
+		}
+		return tx.Delete("account", id)
+	})
+	if err != nil {
+		sendServerError(w, "Failed to delete account", err)
+		return
+	}
+	mockcache.AccountChanged(id)
+
+	response.SendResponse(w, http.StatusOK, "Account deleted successfully", "", nil, false)
+}
+
+// setAccountActive activates or deactivates the account in the path (admin only)
+func setAccountActive(w http.ResponseWriter, r *http.Request, active bool) {
+	id, err := getIDFromVars(r, "id")
 	if err != nil {
 		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
 		return
 	}
 
-	err = crud.Delete("account", id)
+	// Disabling is kept apart from is_active, so verifying the email can't undo it
+	updates := map[string]interface{}{"disabled_at": time.Now()}
+	if active {
+		updates = map[string]interface{}{"is_active": true, "disabled_at": nil}
+	}
+	updatedAccount, err := crud.Update(r.Context(), "account", id, updates)
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to delete account", err.Error(), nil, false)
+		sendLookupError(w, "Failed to update account", err)
 		return
 	}
+	mockcache.AccountChanged(id)
+	updatedAccount["password"] = nil
 
-	response.SendResponse(w, http.StatusOK, "Account deleted successfully", "", nil, false)
+	message := "Account deactivated successfully"
+	if active {
+		message = "Account activated successfully"
+	}
+	response.SendResponse(w, http.StatusOK, message, "", updatedAccount, false)
+}
+
+// ActivateAccountHandler activates an account (admin only)
+func ActivateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	setAccountActive(w, r, true)
+}
+
+// DeactivateAccountHandler deactivates an account so it can no longer log in (admin only)
+func DeactivateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	setAccountActive(w, r, false)
+}
+
+// UpdateAccountRoleHandler changes the role of an account (admin only)
+func UpdateAccountRoleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromVars(r, "id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
+		return
+	}
+
+	var req AccountRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+
+	if req.Role != authz.RoleUser && req.Role != authz.RoleAdmin {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid role", fmt.Sprintf("role must be %q or %q", authz.RoleUser, authz.RoleAdmin), nil, false)
+		return
+	}
+
+	updatedAccount, err := crud.Update(r.Context(), "account", id, map[string]interface{}{"role": req.Role})
+	if err != nil {
+		sendLookupError(w, "Failed to update account role", err)
+		return
+	}
+	updatedAccount["password"] = nil
+
+	response.SendResponse(w, http.StatusOK, "Account role updated successfully", "", updatedAccount, false)
 }
@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/api/authz"
+	"github.com/adolfooes/api_faker/internal/db"
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/adolfooes/api_faker/pkg/utils/mail"
+	"github.com/adolfooes/api_faker/pkg/utils/response"
+)
+
+// Purposes of the single-use account tokens
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailChange       = "email_change"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+	passwordResetTTL     = 1 * time.Hour
+	emailChangeTTL       = 24 * time.Hour
+)
+
+// TokenRequest carries a token sent to the user by email
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+// EmailRequest carries the email of the account a message should be sent to
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+// PasswordResetRequest carries the reset token and the new password
+type PasswordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// hashToken returns the hex encoded SHA-256 of a token, which is what gets stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createAccountToken stores a new single-use token for the account and returns its plain value
+func createAccountToken(ctx context.Context, accountID int64, purpose string, ttl time.Duration) (string, error) {
+	return createEmailToken(ctx, accountID, purpose, nil, ttl)
+}
+
+// createEmailToken stores a new single-use token for the account, bound to the email it confirms (nil for
+// none), and returns its plain value
+func createEmailToken(ctx context.Context, accountID int64, purpose string, email interface{}, ttl time.Duration) (string, error) {
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	// The expiration is computed by the database clock, like the consumption check
+	_, _, err = crud.Raw(ctx,
+		"INSERT INTO account_token (account_id, purpose, email, token_hash, expires_at) VALUES ($1, $2, $3, $4, NOW() + $5::int * INTERVAL '1 second')",
+		accountID, purpose, email, hashToken(token), int64(ttl.Seconds()),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeAccountToken marks a valid token as used and returns the account it belongs to
+func consumeAccountToken(ctx context.Context, token string, purpose string) (int64, error) {
+	accountID, _, err := consumeEmailToken(ctx, token, purpose)
+	return accountID, err
+}
+
+// consumeEmailToken marks a valid token as used and returns the account it belongs to and the email it confirms
+func consumeEmailToken(ctx context.Context, token string, purpose string) (int64, string, error) {
+	tokenHash := hashToken(token)
+
+	tokens, _, err := crud.Raw(ctx,
+		"SELECT id, account_id, email FROM account_token WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()",
+		tokenHash, purpose,
+	)
+	if err != nil || len(tokens) == 0 {
+		return 0, "", fmt.Errorf("invalid or expired token")
+	}
+
+	// Only the request that flips used_at may continue, so a token can't be used twice
+	_, updated, err := crud.Raw(ctx, "UPDATE account_token SET used_at = NOW() WHERE id = $1 AND used_at IS NULL", tokens[0]["id"])
+	if err != nil || updated != 1 {
+		return 0, "", fmt.Errorf("invalid or expired token")
+	}
+
+	return tokens[0].Int64("account_id"), tokens[0].String("email"), nil
+}
+
+// findAccountByEmail returns the account with the given email, or nil if there is none
+func findAccountByEmail(ctx context.Context, email string) (crud.Row, error) {
+	accounts, err := crud.List(ctx, "account", map[string]interface{}{"email": strings.ToLower(email)})
+	if err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, nil
+	}
+	return accounts[0], nil
+}
+
+// sendVerificationEmail creates a verification token and emails the link to the account
+func sendVerificationEmail(ctx context.Context, accountID int64, email string) error {
+	token, err := createAccountToken(ctx, accountID, TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/account/verify?token=%s", config.GetAppBaseURL(), url.QueryEscape(token))
+	body := fmt.Sprintf("Welcome to API Faker!\n\nConfirm your email address to activate your account:\n\n%s\n\nThe link expires in %d hours.\n", link, int(emailVerificationTTL.Hours()))
+	return mail.Send(email, "Verify your API Faker account", body)
+}
+
+// sendPasswordResetEmail creates a reset token and emails the link to the account
+func sendPasswordResetEmail(ctx context.Context, accountID int64, email string) error {
+	token, err := createAccountToken(ctx, accountID, TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/password/reset?token=%s", config.GetAppBaseURL(), url.QueryEscape(token))
+	body := fmt.Sprintf("A password reset was requested for your API Faker account.\n\nUse this token or link to choose a new password:\n\n%s\n\n%s\n\nThe token expires in %d minutes. If you didn't request it, ignore this email.\n", token, link, int(passwordResetTTL.Minutes()))
+	return mail.Send(email, "Reset your API Faker password", body)
+}
+
+// sendEmailChangeEmail emails a link confirming the new email of the account to that address. The tokens sent
+// for earlier changes are no longer valid.
+func sendEmailChangeEmail(ctx context.Context, accountID int64, email string) error {
+	_, _, err := crud.Raw(ctx, "UPDATE account_token SET used_at = NOW() WHERE account_id = $1 AND purpose = $2 AND used_at IS NULL", accountID, TokenPurposeEmailChange)
+	if err != nil {
+		return err
+	}
+
+	token, err := createEmailToken(ctx, accountID, TokenPurposeEmailChange, email, emailChangeTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/account/email/confirm?token=%s", config.GetAppBaseURL(), url.QueryEscape(token))
+	body := fmt.Sprintf("The email of your API Faker account is being changed to this address.\n\nConfirm it to complete the change:\n\n%s\n\nThe link expires in %d hours. If you didn't ask for it, ignore this email.\n", link, int(emailChangeTTL.Hours()))
+	return mail.Send(email, "Confirm your new API Faker email", body)
+}
+
+// tokenFromRequest reads the token of an emailed link (GET) or of a JSON body (POST)
+func tokenFromRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	token := r.URL.Query().Get("token")
+	if r.Method == http.MethodPost {
+		var req TokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+			return "", false
+		}
+		token = req.Token
+	}
+
+	if token == "" {
+		response.SendResponse(w, http.StatusBadRequest, "Token is required", "", nil, false)
+		return "", false
+	}
+	return token, true
+}
+
+// VerifyEmailHandler activates the account the verification token was issued for
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := tokenFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	accountID, err := consumeAccountToken(r.Context(), token, TokenPurposeEmailVerification)
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Email verification failed", err.Error(), nil, false)
+		return
+	}
+
+	// Only an unverified account is activated, an account disabled by an admin stays disabled
+	_, updated, err := crud.Raw(r.Context(),
+		"UPDATE account SET is_active = TRUE, email_verified_at = NOW() WHERE id = $1 AND email_verified_at IS NULL", accountID)
+	if err != nil {
+		sendServerError(w, "Failed to activate account", err)
+		return
+	}
+	if updated == 0 {
+		response.SendResponse(w, http.StatusBadRequest, "Email verification failed", "the email is already verified", nil, false)
+		return
+	}
+
+	// The bootstrap admin gets its role once it proves it owns the address
+	if err := authz.PromoteBootstrapAdmin(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to promote bootstrap admin", "account_id", accountID, "error", err)
+	}
+
+	response.SendResponse(w, http.StatusOK, "Email verified successfully", "", nil, false)
+}
+
+// ConfirmEmailChangeHandler replaces the email of the account with the pending email the token was sent to
+func ConfirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := tokenFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	accountID, email, err := consumeEmailToken(r.Context(), token, TokenPurposeEmailChange)
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Email change failed", err.Error(), nil, false)
+		return
+	}
+
+	// The change only applies while the email is still the pending one, a newer change supersedes it
+	_, updated, err := crud.Raw(r.Context(),
+		"UPDATE account SET email = $2, pending_email = NULL, email_verified_at = NOW() WHERE id = $1 AND pending_email = $2",
+		accountID, email,
+	)
+	if db.IsUniqueViolation(err) {
+		response.SendResponse(w, http.StatusConflict, "Account with this email already exists", "", nil, false)
+		return
+	}
+	if err != nil {
+		sendServerError(w, "Failed to change email", err)
+		return
+	}
+	if updated == 0 {
+		response.SendResponse(w, http.StatusBadRequest, "Email change failed", "the email change was cancelled or superseded", nil, false)
+		return
+	}
+
+	response.SendResponse(w, http.StatusOK, "Email changed successfully", "", nil, false)
+}
+
+// ResendVerificationHandler sends a new verification email to an unverified account
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var req EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+
+	account, err := findAccountByEmail(r.Context(), req.Email)
+	if err != nil {
+		sendServerError(w, "Error searching for account", err)
+		return
+	}
+
+	// The response is the same whether the account exists or not, to avoid leaking emails
+	if account != nil && account["email_verified_at"] == nil {
+		if err := sendVerificationEmail(r.Context(), account.Int64("id"), account.String("email")); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to send verification email", "account_id", account.Int64("id"), "error", err)
+		}
+	}
+
+	response.SendResponse(w, http.StatusOK, "If the account exists and is not verified, a verification email was sent", "", nil, false)
+}
+
+// ForgotPasswordHandler emails a password reset token to the account
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+
+	if err := validateEmailFormat(req.Email); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid email format", err.Error(), nil, false)
+		return
+	}
+
+	account, err := findAccountByEmail(r.Context(), req.Email)
+	if err != nil {
+		sendServerError(w, "Error searching for account", err)
+		return
+	}
+
+	// The response is the same whether the account exists or not, to avoid leaking emails
+	if account != nil {
+		if err := sendPasswordResetEmail(r.Context(), account.Int64("id"), account.String("email")); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to send password reset email", "account_id", account.Int64("id"), "error", err)
+		}
+	}
+
+	response.SendResponse(w, http.StatusOK, "If the account exists, a password reset email was sent", "", nil, false)
+}
+
+// ResetPasswordHandler sets a new password using a password reset token
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+
+	if req.Token == "" {
+		response.SendResponse(w, http.StatusBadRequest, "Token is required", "", nil, false)
+		return
+	}
+
+	// Validate the new password before the token is consumed
+	if err := validatePassword(req.Password); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Weak password", err.Error(), nil, false)
+		return
+	}
+
+	accountID, err := consumeAccountToken(r.Context(), req.Token, TokenPurposePasswordReset)
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Password reset failed", err.Error(), nil, false)
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.Password)
+	if err != nil {
+		sendServerError(w, "Failed to hash password", err)
+		return
+	}
+
+	if _, err := crud.Update(r.Context(), "account", accountID, map[string]interface{}{"password": hashedPassword}); err != nil {
+		sendServerError(w, "Failed to reset password", err)
+		return
+	}
+
+	// Any other reset token still pending for the account is no longer valid
+	_, _, err = crud.Raw(r.Context(), "UPDATE account_token SET used_at = NOW() WHERE account_id = $1 AND purpose = $2 AND used_at IS NULL", accountID, TokenPurposePasswordReset)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to invalidate password reset tokens", "account_id", accountID, "error", err)
+	}
+
+	response.SendResponse(w, http.StatusOK, "Password reset successfully", "", nil, false)
+}
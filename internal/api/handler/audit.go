@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/adolfooes/api_faker/internal/api/authz"
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/adolfooes/api_faker/pkg/utils/response"
+)
+
+var auditLogListSpec = listSpec{
+	table:       "audit_log",
+	name:        "audit log",
+	filterable:  []string{"table_name", "record_id", "action", "actor_id"},
+	sortable:    []string{"id", "created_at"},
+	defaultSort: []crud.SortField{{Column: "created_at", Desc: true}, {Column: "id", Desc: true}},
+	format: func(row crud.Row) crud.Row {
+		row["before"] = row.JSON("before")
+		row["after"] = row.JSON("after")
+		return row
+	},
+}
+
+// GetProjectAuditLogHandler lists the configuration changes made to a project, newest first.
+// Results can be narrowed with the table_name, record_id, action and actor_id query parameters.
+func GetProjectAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := getIDFromVars(r, "id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid project ID", err.Error(), nil, false)
+		return
+	}
+
+	ownerID, err := authz.AccountID(r)
+	if err != nil {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Owner ID not found", err.Error(), nil, false)
+		return
+	}
+
+	if err := authorizeProjectOwnership(r.Context(), projectID, ownerID); err != nil {
+		sendAuthorizationError(w, err)
+		return
+	}
+
+	sendList(w, r, auditLogListSpec, map[string]interface{}{"project_id": projectID}, "Audit log retrieved successfully")
+}
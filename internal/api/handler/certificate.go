@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/mockcache"
+	"github.com/adolfooes/api_faker/internal/pki"
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/adolfooes/api_faker/pkg/utils/response"
+)
+
+// ClientCertificateRequest is the subject and validity of a client certificate issued for a project
+type ClientCertificateRequest struct {
+	CommonName         string `json:"common_name"`
+	Organization       string `json:"organization"`
+	OrganizationalUnit string `json:"organizational_unit"`
+	ValidDays          int    `json:"valid_days"` // TLS_CLIENT_CERT_TTL when 0
+}
+
+// ClientCertRequirement turns mTLS on or off for the mocks of a project
+type ClientCertRequirement struct {
+	RequireClientCert bool `json:"require_client_cert"`
+}
+
+// maxClientCertDays is the longest validity a client certificate can be issued with
+const maxClientCertDays = 3650
+
+func validateClientCertificateRequest(req ClientCertificateRequest) error {
+	if req.CommonName == "" {
+		return fmt.Errorf("common_name is required")
+	}
+	if len(req.CommonName) > 64 {
+		return fmt.Errorf("common_name cannot be longer than 64 characters")
+	}
+	if req.ValidDays < 0 || req.ValidDays > maxClientCertDays {
+		return fmt.Errorf("valid_days must be between 1 and %d, or 0 for the default validity", maxClientCertDays)
+	}
+	return nil
+}
+
+// verifiedClientCertificate returns the client certificate of the request, nil when the request wasn't
+// made over TLS with a certificate the server verified
+func verifiedClientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// checkClientCertificate returns an error when a project requiring mTLS can't serve the request: it has
+// no verified client certificate, or one the faker's CA issued for another project
+func checkClientCertificate(r *http.Request, table *mockcache.Table) error {
+	cert := verifiedClientCertificate(r)
+	if cert == nil {
+		return fmt.Errorf("the project requires a client certificate")
+	}
+	if !certificateMatchesProject(cert, table.ProjectID) {
+		return fmt.Errorf("the client certificate was issued for another project")
+	}
+	return nil
+}
+
+// certificateMatchesProject reports whether a client certificate may be used with the project: the certificates
+// of the generated CA are bound to the project they were issued for, those of other CAs to none
+func certificateMatchesProject(cert *x509.Certificate, projectID int64) bool {
+	issuedFor, ok := pki.ProjectID(cert)
+	return !ok || issuedFor == projectID
+}
+
+// CACertificateHandler serves the certificate of the faker's CA, which clients trust to call the server
+// over TLS in auto mode
+func CACertificateHandler(w http.ResponseWriter, r *http.Request) {
+	ca := pki.Default()
+	if ca == nil {
+		response.SendResponse(w, http.StatusNotFound, "The server doesn't run a certificate authority, see tls.auto", "", nil, false)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", `attachment; filename="api_faker_ca.crt"`)
+	w.Write(ca.CertificatePEM())
+}
+
+// CreateClientCertificateHandler issues a client certificate for a project, signed by the faker's CA.
+// The private key is generated by the server and isn't kept, the response is the only copy of it.
+// With ?format=pem the certificate, key and CA certificate are downloaded as a single PEM file.
+func CreateClientCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, _, ok := requireProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	ca := pki.Default()
+	if ca == nil {
+		response.SendResponse(w, http.StatusConflict, "The server doesn't run a certificate authority, see tls.auto", "", nil, false)
+		return
+	}
+
+	var req ClientCertificateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+	req.CommonName = strings.TrimSpace(req.CommonName)
+
+	if err := validateClientCertificateRequest(req); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Validation failed", err.Error(), nil, false)
+		return
+	}
+
+	subject := pkix.Name{CommonName: req.CommonName}
+	if organization := strings.TrimSpace(req.Organization); organization != "" {
+		subject.Organization = []string{organization}
+	}
+	if unit := strings.TrimSpace(req.OrganizationalUnit); unit != "" {
+		subject.OrganizationalUnit = []string{unit}
+	}
+	validity := config.GetTLS().ClientCertTTL
+	if req.ValidDays > 0 {
+		validity = time.Duration(req.ValidDays) * 24 * time.Hour
+	}
+
+	cert, err := ca.IssueClientCertificate(projectID, subject, validity)
+	if err != nil {
+		sendServerError(w, "Failed to issue client certificate", err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "pem" {
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="project_%d_client.pem"`, projectID))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, cert.Certificate, cert.PrivateKey, cert.CACertificate)
+		return
+	}
+
+	response.SendResponse(w, http.StatusCreated, "Client certificate issued successfully", "", cert, false)
+}
+
+// SetClientCertRequirementHandler turns mTLS on or off for the mocks of a project
+func SetClientCertRequirementHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ownerID, ok := requireProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var req ClientCertRequirement
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+
+	updatedProject, err := crud.UpdateAudited(r.Context(), ownerID, "project", projectID, map[string]interface{}{"require_client_cert": req.RequireClientCert})
+	if err != nil {
+		sendServerError(w, "Failed to update client certificate requirement", err)
+		return
+	}
+
+	response.SendResponse(w, http.StatusOK, "Client certificate requirement updated successfully", "", updatedProject, false)
+}
@@ -0,0 +1,309 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/adolfooes/api_faker/pkg/utils/response"
+)
+
+// Endpoint is a complete mocked endpoint: a URL config with its HTTP statuses and their response models
+type Endpoint struct {
+	ID          int64            `json:"id,omitempty"`
+	Path        string           `json:"path"`
+	Method      string           `json:"method"`
+	Description string           `json:"description"`
+	Statuses    []EndpointStatus `json:"statuses"`
+}
+
+// EndpointStatus is one of the HTTP statuses of an endpoint with the model it responds with
+type EndpointStatus struct {
+	ID               int64             `json:"id,omitempty"`
+	HTTPStatus       int               `json:"http_status"`
+	Percentage       int               `json:"percentage"`
+	VariantID        *int64            `json:"variant_id"`
+	Trailers         map[string]string `json:"trailers,omitempty"`
+	EarlyHints       []string          `json:"early_hints,omitempty"`
+	ModelID          int64             `json:"model_id,omitempty"`
+	Model            interface{}       `json:"model"`
+	ModelDescription string            `json:"model_description"`
+}
+
+// validateEndpoint checks an endpoint document before anything is written
+func validateEndpoint(ctx context.Context, projectID int64, endpoint Endpoint) error {
+	if err := validatePathFormat(endpoint.Path); err != nil {
+		return err
+	}
+	if err := validateHTTPMethod(endpoint.Method); err != nil {
+		return err
+	}
+	if len(endpoint.Statuses) == 0 {
+		return fmt.Errorf("at least one status is required")
+	}
+
+	// Each variant (and the default responses) is a percentage distribution of its own
+	totals := map[int64]int{}
+	for i, status := range endpoint.Statuses {
+		if err := validateHTTPStatusCode(status.HTTPStatus); err != nil {
+			return fmt.Errorf("statuses[%d]: %w", i, err)
+		}
+		if status.Percentage < 0 || status.Percentage > 100 {
+			return fmt.Errorf("statuses[%d]: percentage must be between 0 and 100", i)
+		}
+		if status.Model == nil {
+			return fmt.Errorf("statuses[%d]: model is required", i)
+		}
+		if err := validateTrailers(status.Trailers); err != nil {
+			return fmt.Errorf("statuses[%d]: %w", i, err)
+		}
+		if err := validateEarlyHints(status.EarlyHints); err != nil {
+			return fmt.Errorf("statuses[%d]: %w", i, err)
+		}
+
+		var variantID int64
+		if status.VariantID != nil {
+			variantID = *status.VariantID
+			if _, err := findProjectVariant(ctx, projectID, variantID); err != nil {
+				return fmt.Errorf("statuses[%d]: %w", i, err)
+			}
+		}
+
+		totals[variantID] += status.Percentage
+		if totals[variantID] > 100 {
+			return fmt.Errorf("total percentage exceeds 100%%")
+		}
+	}
+
+	return nil
+}
+
+// loadEndpoints returns the endpoints of a project in the nested shape, optionally only the one with urlID
+func loadEndpoints(ctx context.Context, projectID int64, urlID int64) ([]Endpoint, error) {
+	filters := map[string]interface{}{"project_id": projectID}
+	if urlID != 0 {
+		filters["id"] = urlID
+	}
+	urlConfigs, err := crud.List(ctx, "url_config", filters)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, _, err := crud.Raw(ctx,
+		`SELECT s.id, s.url_id, s.http_status, s.percentage, s.variant_id, s.trailers, s.early_hints FROM url_http_status s
+		JOIN url_config uc ON uc.id = s.url_id
+		WHERE uc.project_id = $1 ORDER BY s.id`,
+		projectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// The mock handler responds with the first model of a status, so that is the one returned
+	models, _, err := crud.Raw(ctx,
+		`SELECT DISTINCT ON (m.url_http_status_id) m.id, m.url_http_status_id, m.model, m.description FROM response_model m
+		JOIN url_http_status s ON s.id = m.url_http_status_id
+		JOIN url_config uc ON uc.id = s.url_id
+		WHERE uc.project_id = $1 ORDER BY m.url_http_status_id, m.id`,
+		projectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	modelsByStatus := map[int64]crud.Row{}
+	for _, model := range models {
+		modelsByStatus[model.Int64("url_http_status_id")] = model
+	}
+
+	statusesByURL := map[int64][]EndpointStatus{}
+	for _, status := range statuses {
+		endpointStatus := EndpointStatus{
+			ID:         status.Int64("id"),
+			HTTPStatus: status.Int("http_status"),
+			Percentage: status.Int("percentage"),
+		}
+		if variantID, ok := status.NullInt64("variant_id"); ok {
+			endpointStatus.VariantID = &variantID
+		}
+		if trailers := status.JSON("trailers"); trailers != nil {
+			_ = json.Unmarshal(trailers, &endpointStatus.Trailers)
+		}
+		if earlyHints := status.JSON("early_hints"); earlyHints != nil {
+			_ = json.Unmarshal(earlyHints, &endpointStatus.EarlyHints)
+		}
+		if model, ok := modelsByStatus[endpointStatus.ID]; ok {
+			endpointStatus.ModelID = model.Int64("id")
+			endpointStatus.Model = model.JSON("model")
+			endpointStatus.ModelDescription = model.String("description")
+		}
+
+		urlID := status.Int64("url_id")
+		statusesByURL[urlID] = append(statusesByURL[urlID], endpointStatus)
+	}
+
+	endpoints := make([]Endpoint, 0, len(urlConfigs))
+	for _, urlConfig := range urlConfigs {
+		id := urlConfig.Int64("id")
+		endpoint := Endpoint{
+			ID:          id,
+			Path:        urlConfig.String("path"),
+			Method:      urlConfig.String("method"),
+			Description: urlConfig.String("description"),
+			Statuses:    statusesByURL[id],
+		}
+		if endpoint.Statuses == nil {
+			endpoint.Statuses = []EndpointStatus{}
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].ID < endpoints[j].ID })
+	return endpoints, nil
+}
+
+// CreateEndpointHandler creates a URL config with all its statuses and response models in one transaction
+func CreateEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ownerID, ok := requireProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	project, err := crud.Read(r.Context(), "project", projectID)
+	if err != nil {
+		sendLookupError(w, "Project not found", err)
+		return
+	}
+	if project["type"] == ProjectTypeOIDC {
+		response.SendResponse(w, http.StatusBadRequest, "Project is an OIDC project and has no mocked URLs", "", nil, false)
+		return
+	}
+
+	var endpoint Endpoint
+	if err := json.NewDecoder(r.Body).Decode(&endpoint); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+
+	if err := validateEndpoint(r.Context(), projectID, endpoint); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Validation failed", err.Error(), nil, false)
+		return
+	}
+
+	// Models are stored as JSONB, so they are sent to the database encoded
+	models := make([]string, len(endpoint.Statuses))
+	for i, status := range endpoint.Statuses {
+		encoded, err := json.Marshal(status.Model)
+		if err != nil {
+			response.SendResponse(w, http.StatusBadRequest, "Invalid model", fmt.Sprintf("statuses[%d]: %v", i, err), nil, false)
+			return
+		}
+		models[i] = string(encoded)
+	}
+
+	var urlID int64
+	err = crud.WithTx(r.Context(), func(tx *crud.Tx) error {
+		if err := tx.Lock("project", projectID); err != nil {
+			return err
+		}
+
+		exists, err := checkDuplicateURLConfig(tx, projectID, endpoint.Path, endpoint.Method, 0)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return validationError{fmt.Errorf("URL config with the same path and method already exists")}
+		}
+
+		urlConfig, err := tx.CreateAudited(ownerID, "url_config",
+			[]string{"path", "method", "description", "project_id"},
+			[]interface{}{endpoint.Path, endpoint.Method, endpoint.Description, projectID},
+		)
+		if err != nil {
+			return err
+		}
+		urlID = urlConfig.Int64("id")
+
+		for i, status := range endpoint.Statuses {
+			trailers, earlyHints := protocolOptionValues(status.Trailers, status.EarlyHints)
+			createdStatus, err := tx.CreateAudited(ownerID, "url_http_status",
+				[]string{"url_id", "http_status", "percentage", "variant_id", "trailers", "early_hints"},
+				[]interface{}{urlID, status.HTTPStatus, status.Percentage, status.VariantID, trailers, earlyHints},
+			)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.CreateAudited(ownerID, "response_model",
+				[]string{"url_http_status_id", "model", "description"},
+				[]interface{}{createdStatus["id"], models[i], status.ModelDescription},
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if isValidationError(err) {
+		response.SendResponse(w, http.StatusConflict, err.Error(), "", nil, false)
+		return
+	}
+	if err != nil {
+		sendServerError(w, "Failed to create endpoint", err)
+		return
+	}
+
+	endpoints, err := loadEndpoints(r.Context(), projectID, urlID)
+	if err != nil || len(endpoints) == 0 {
+		response.SendResponse(w, http.StatusInternalServerError, "Failed to retrieve endpoint", fmt.Sprint(err), nil, false)
+		return
+	}
+
+	response.SendResponse(w, http.StatusCreated, "Endpoint created successfully", "", endpoints[0], false)
+}
+
+// GetAllEndpointsHandler lists the endpoints of a project with their statuses and models
+func GetAllEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, _, ok := requireProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	endpoints, err := loadEndpoints(r.Context(), projectID, 0)
+	if err != nil {
+		sendServerError(w, "Failed to retrieve endpoints", err)
+		return
+	}
+
+	response.SendResponse(w, http.StatusOK, "Endpoints retrieved successfully", "", endpoints, false)
+}
+
+// GetEndpointHandler retrieves one endpoint of a project with its statuses and models
+func GetEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, _, ok := requireProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	urlID, err := getIDFromVars(r, "url_id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid URL ID", err.Error(), nil, false)
+		return
+	}
+
+	endpoints, err := loadEndpoints(r.Context(), projectID, urlID)
+	if err != nil {
+		sendServerError(w, "Failed to retrieve endpoint", err)
+		return
+	}
+	if len(endpoints) == 0 {
+		response.SendResponse(w, http.StatusNotFound, "Endpoint not found", "", nil, false)
+		return
+	}
+
+	response.SendResponse(w, http.StatusOK, "Endpoint retrieved successfully", "", endpoints[0], false)
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/adolfooes/api_faker/internal/db"
+	"github.com/adolfooes/api_faker/internal/version"
+	"github.com/adolfooes/api_faker/pkg/utils/response"
+)
+
+// draining is set once the server is shutting down, so it is taken out of the load balancers
+var draining atomic.Bool
+
+// StartDraining makes the readiness endpoint fail from now on, while the server finishes its requests
+func StartDraining() {
+	draining.Store(true)
+}
+
+// ReadinessCheck is the result of one of the checks of the readiness endpoint
+type ReadinessCheck struct {
+	Status string `json:"status"` // ok or failing
+	Error  string `json:"error,omitempty"`
+}
+
+// readinessCheck returns the check result of err
+func readinessCheck(err error) ReadinessCheck {
+	if err != nil {
+		return ReadinessCheck{Status: "failing", Error: err.Error()}
+	}
+	return ReadinessCheck{Status: "ok"}
+}
+
+// HealthzHandler reports that the server is alive. It doesn't check its dependencies, so a database
+// outage makes the server unready rather than restarted.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	response.SendResponse(w, http.StatusOK, "ok", "", nil, false)
+}
+
+// ReadyzHandler reports whether the server can serve requests: it isn't shutting down, the database
+// answers and its schema is at the version the server migrated it to. It responds with 503 when a check fails.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]ReadinessCheck{}
+
+	if draining.Load() {
+		checks["shutdown"] = readinessCheck(errors.New("the server is shutting down"))
+		response.SendResponse(w, http.StatusServiceUnavailable, "not ready", "", checks, false)
+		return
+	}
+
+	ctx, cancel := db.WithQueryTimeout(r.Context())
+	defer cancel()
+
+	err := db.GetDB().PingContext(ctx)
+	checks["database"] = readinessCheck(err)
+
+	if err == nil {
+		checks["migrations"] = readinessCheck(checkSchemaVersion(r))
+	}
+
+	for _, check := range checks {
+		if check.Status != "ok" {
+			response.SendResponse(w, http.StatusServiceUnavailable, "not ready", "", checks, false)
+			return
+		}
+	}
+	response.SendResponse(w, http.StatusOK, "ready", "", checks, false)
+}
+
+// checkSchemaVersion returns an error when the schema is behind the version migrated to at startup, or
+// when a migration failed halfway through
+func checkSchemaVersion(r *http.Request) error {
+	current, dirty, err := db.SchemaVersion(r.Context())
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d failed and left the schema dirty", current)
+	}
+	if current < db.MigratedVersion() {
+		return fmt.Errorf("schema version %d is behind the expected version %d", current, db.MigratedVersion())
+	}
+	return nil
+}
+
+// VersionHandler returns the build information of the server
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	response.SendResponse(w, http.StatusOK, "", "", version.Get(), false)
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adolfooes/api_faker/internal/api/authz"
+	"github.com/adolfooes/api_faker/internal/db"
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/adolfooes/api_faker/pkg/utils/response"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// listSpec describes how the rows of a table can be listed through the query string
+type listSpec struct {
+	table string
+	// name is the plural name of the rows, used in error messages
+	name string
+	// filterable columns can be matched with ?column=value
+	filterable []string
+	// sortable columns can be used with ?sort=column or ?sort=-column (descending), comma separated
+	sortable    []string
+	defaultSort []crud.SortField
+	// format converts a row into its API representation, when set
+	format func(row crud.Row) crud.Row
+	// scoped lists only show the rows of the projects the caller owns or is a member of
+	scoped bool
+}
+
+func containsColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// parseListOptions reads limit, offset, sort and the column filters of a list request
+func parseListOptions(r *http.Request, spec listSpec) (crud.ListOptions, error) {
+	options := crud.ListOptions{
+		Filters: map[string]interface{}{},
+		Sort:    spec.defaultSort,
+		Limit:   defaultPageLimit,
+	}
+
+	for key, values := range r.URL.Query() {
+		value := values[0]
+		switch key {
+		case "limit":
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit <= 0 || limit > maxPageLimit {
+				return options, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+			}
+			options.Limit = limit
+		case "offset":
+			offset, err := strconv.Atoi(value)
+			if err != nil || offset < 0 {
+				return options, fmt.Errorf("offset must be zero or positive")
+			}
+			options.Offset = offset
+		case "sort":
+			options.Sort = nil
+			for _, field := range strings.Split(value, ",") {
+				sortField := crud.SortField{Column: strings.TrimSpace(field)}
+				if strings.HasPrefix(sortField.Column, "-") {
+					sortField.Column = sortField.Column[1:]
+					sortField.Desc = true
+				}
+				if !containsColumn(spec.sortable, sortField.Column) {
+					return options, fmt.Errorf("cannot sort by %q, sortable fields are: %s", sortField.Column, strings.Join(spec.sortable, ", "))
+				}
+				options.Sort = append(options.Sort, sortField)
+			}
+		default:
+			if !containsColumn(spec.filterable, key) {
+				return options, fmt.Errorf("cannot filter by %q, filterable fields are: %s", key, strings.Join(spec.filterable, ", "))
+			}
+			filter, err := parseFilterValue(spec.table, key, value)
+			if err != nil {
+				return options, err
+			}
+			options.Filters[key] = filter
+		}
+	}
+
+	return options, nil
+}
+
+// parseFilterValue converts the value of a filter to the type of its column, so bad input is refused
+// before it reaches the database
+func parseFilterValue(table string, column string, value string) (interface{}, error) {
+	columnType, ok := crud.ColumnTypeOf(table, column)
+	if !ok {
+		return value, nil
+	}
+	switch columnType {
+	case crud.ColumnInt:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an integer", column)
+		}
+		return parsed, nil
+	case crud.ColumnBool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false", column)
+		}
+		return parsed, nil
+	case crud.ColumnTime:
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an RFC 3339 time", column)
+		}
+		return parsed, nil
+	case crud.ColumnEnum:
+		if !db.IsEnumValue(table, column, value) {
+			return nil, fmt.Errorf("%s must be one of: %s", column, strings.Join(db.EnumValues(table, column), ", "))
+		}
+	}
+	return value, nil
+}
+
+// sendList responds with one page of the rows of a table. The fixed filters are applied on top of the
+// filters of the query string and can't be overridden by it.
+func sendList(w http.ResponseWriter, r *http.Request, spec listSpec, fixedFilters map[string]interface{}, message string) {
+	options, err := parseListOptions(r, spec)
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid list parameters", err.Error(), nil, false)
+		return
+	}
+	for key, value := range fixedFilters {
+		options.Filters[key] = value
+	}
+
+	if spec.scoped {
+		accountID, err := authz.AccountID(r)
+		if err != nil {
+			response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Account ID not found", err.Error(), nil, false)
+			return
+		}
+		options.Conditions, err = authz.Scope(r.Context(), accountID, spec.table)
+		if err != nil {
+			sendServerError(w, "Failed to retrieve "+spec.name, err)
+			return
+		}
+	}
+
+	results, total, err := crud.ListPage(r.Context(), spec.table, options)
+	if err != nil {
+		sendServerError(w, "Failed to retrieve "+spec.name, err)
+		return
+	}
+
+	if spec.format != nil {
+		for _, result := range results {
+			spec.format(result)
+		}
+	}
+
+	response.SendPage(w, message, results, response.Page{
+		Total:   total,
+		Limit:   options.Limit,
+		Offset:  options.Offset,
+		HasMore: int64(options.Offset+len(results)) < total,
+	})
+}
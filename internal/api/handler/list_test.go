@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseListOptionsFilters(t *testing.T) {
+	spec := listSpec{table: "project", filterable: []string{"name", "type", "is_active", "owner_id", "created_at"}}
+
+	tests := []struct {
+		query   string
+		column  string
+		want    interface{}
+		wantErr string
+	}{
+		{query: "owner_id=12", column: "owner_id", want: int64(12)},
+		{query: "is_active=false", column: "is_active", want: false},
+		{query: "type=oidc", column: "type", want: "oidc"},
+		{query: "name=abc", column: "name", want: "abc"},
+		{query: "created_at=2024-01-02T03:04:05Z", column: "created_at", want: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{query: "owner_id=abc", wantErr: "owner_id must be an integer"},
+		{query: "is_active=yes", wantErr: "is_active must be true or false"},
+		{query: "type=other", wantErr: "type must be one of: mock, oidc"},
+		{query: "created_at=2024-01-01", wantErr: "created_at must be an RFC 3339 time"},
+		{query: "updated_at=2024-01-01T00:00:00Z", wantErr: `cannot filter by "updated_at"`},
+	}
+
+	for _, tt := range tests {
+		options, err := parseListOptions(httptest.NewRequest("GET", "/api/project?"+tt.query, nil), spec)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.query, err)
+			continue
+		}
+		if got := options.Filters[tt.column]; got != tt.want {
+			t.Errorf("%s: filter = %#v, want %#v", tt.query, got, tt.want)
+		}
+	}
+}
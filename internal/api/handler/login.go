@@ -2,13 +2,15 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/mail"
-	"strings"
 	"time"
 
 	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/repository"
 	"github.com/adolfooes/api_faker/pkg/utils/crud"
 	"github.com/adolfooes/api_faker/pkg/utils/response"
 	"github.com/golang-jwt/jwt/v5"
@@ -66,37 +68,57 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Search for the account using the email (case-insensitive)
-	filter := map[string]interface{}{"email": strings.ToLower(creds.Email)}
-	results, err := crud.List("account", filter) // Alternatively, modify Read to accept filters
+	// Refuse to check passwords while the email or the client IP is locked out
+	ip := clientIP(r)
+	remaining, err := checkLoginThrottle(r.Context(), creds.Email, ip)
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Error searching for account", err.Error(), nil, false)
+		sendServerError(w, "Error checking login attempts", err)
+		return
+	}
+	if remaining > 0 {
+		sendLockedResponse(w, remaining)
 		return
 	}
 
-	if len(results) == 0 {
+	// Search for the account using the email (case-insensitive)
+	account, err := repository.Default().GetAccountByEmail(r.Context(), creds.Email)
+	if errors.Is(err, repository.ErrNotFound) {
 		// No account found with that email
+		registerLoginFailure(r.Context(), creds.Email, ip, nil)
 		response.SendResponse(w, http.StatusUnauthorized, "Invalid credentials", "", nil, false)
 		return
 	}
-
-	// Since we're querying by email, only one result is expected
-	account := results[0]
+	if err != nil {
+		sendServerError(w, "Error searching for account", err)
+		return
+	}
 
 	// Compare the provided password with the hashed password in the database
-	storedPassword := account["password"].(string)
-	err = bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(creds.Password))
+	err = bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(creds.Password))
 	if err != nil {
 		// Password does not match
+		registerLoginFailure(r.Context(), creds.Email, ip, account.ID)
 		response.SendResponse(w, http.StatusUnauthorized, "Invalid credentials", "", nil, false)
 		return
 	}
 
+	// Accounts must be active (verified and not disabled) to sign in
+	if !account.CanSignIn() {
+		response.SendResponse(w, http.StatusForbidden, "Account is not active", "verify your email address or contact an administrator", nil, false)
+		return
+	}
+
 	// Get the account ID from the account object
-	accountID := account["id"].(int64)
+	accountID := account.ID
+
+	// A successful login resets the failure counter and is remembered as the last login
+	clearLoginFailures(r.Context(), creds.Email)
+	if _, _, err := crud.Raw(r.Context(), "UPDATE account SET last_login = NOW() WHERE id = $1", accountID); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to update last login", "account_id", accountID, "error", err)
+	}
 
 	// Set JWT expiration time
-	expirationTime := time.Now().Add(1 * time.Hour)
+	expirationTime := time.Now().Add(config.GetJWTTTL())
 
 	// Create JWT claims, including the user's email, account_id, and expiration time
 	claims := &Claims{
@@ -111,7 +133,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(config.GetJWTSecretKey())
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to generate token", err.Error(), nil, false)
+		sendServerError(w, "Failed to generate token", err)
 		return
 	}
 
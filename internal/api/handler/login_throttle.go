@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/api/authz"
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/adolfooes/api_faker/pkg/utils/response"
+)
+
+// Security events recorded for lockouts
+const (
+	SecurityEventLockout        = "lockout"
+	SecurityEventLockoutCleared = "lockout_cleared"
+)
+
+// emailThrottleKey is the login_throttle key that counts failures for an email
+func emailThrottleKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+// ipThrottleKey is the login_throttle key that counts failures for a client IP
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// clientIP returns the IP address of the client that sent the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// lockoutDuration doubles the base lockout for every failure past the limit, up to the configured maximum
+func lockoutDuration(failedAttempts int, maxAttempts int) time.Duration {
+	base := config.GetLoginLockoutBase()
+	maxLockout := config.GetLoginLockoutMax()
+
+	exponent := failedAttempts - maxAttempts
+	if exponent > 30 {
+		return maxLockout
+	}
+
+	duration := time.Duration(float64(base) * math.Pow(2, float64(exponent)))
+	if duration > maxLockout {
+		return maxLockout
+	}
+	return duration
+}
+
+// getLoginLockout returns how long the key is still locked, or zero when it isn't
+func getLoginLockout(ctx context.Context, key string) (time.Duration, error) {
+	results, _, err := crud.Raw(ctx,
+		"SELECT EXTRACT(EPOCH FROM (locked_until - NOW()))::float8 AS remaining FROM login_throttle WHERE key = $1 AND locked_until > NOW()",
+		key,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+
+	remaining := results[0].Float64("remaining")
+	return time.Duration(remaining * float64(time.Second)), nil
+}
+
+// recordLoginFailure counts a failed login for the key and locks it once the limit is reached.
+// It returns the lockout duration, or zero if the key was not locked.
+func recordLoginFailure(ctx context.Context, key string, maxAttempts int) (time.Duration, error) {
+	// Counters start over when the last failure (or the end of the last lockout) is older than the attempt window
+	results, _, err := crud.Raw(ctx,
+		`INSERT INTO login_throttle (key, failed_attempts, last_failed_at) VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			failed_attempts = CASE
+				WHEN GREATEST(login_throttle.last_failed_at, login_throttle.locked_until) < NOW() - $2::int * INTERVAL '1 second' THEN 1
+				ELSE login_throttle.failed_attempts + 1
+			END,
+			last_failed_at = NOW()
+		RETURNING failed_attempts`,
+		key, int64(config.GetLoginAttemptWindow().Seconds()),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error recording failed login: %w", err)
+	}
+	if len(results) == 0 {
+		return 0, fmt.Errorf("error recording failed login: no counter returned")
+	}
+
+	failedAttempts := results[0].Int("failed_attempts")
+	if failedAttempts < maxAttempts {
+		return 0, nil
+	}
+
+	duration := lockoutDuration(failedAttempts, maxAttempts)
+	_, _, err = crud.Raw(ctx,
+		"UPDATE login_throttle SET locked_until = NOW() + $2::int * INTERVAL '1 second' WHERE key = $1",
+		key, int64(duration.Seconds()),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error locking login: %w", err)
+	}
+
+	return duration, nil
+}
+
+// recordSecurityEvent stores a lockout related event, logging instead of failing the request on errors
+func recordSecurityEvent(ctx context.Context, event string, key string, accountID interface{}, ip string, actorID interface{}, details string) {
+	columns := []string{"event", "throttle_key", "account_id", "ip_address", "actor_id", "details"}
+	values := []interface{}{event, key, accountID, ip, actorID, details}
+	if _, err := crud.Create(ctx, "security_event", columns, values); err != nil {
+		slog.ErrorContext(ctx, "Failed to record security event", "event", event, "key", key, "error", err)
+	}
+}
+
+// checkLoginThrottle returns the remaining lockout of the email or the client IP, whichever is longer
+func checkLoginThrottle(ctx context.Context, email string, ip string) (time.Duration, error) {
+	var longest time.Duration
+	for _, key := range []string{emailThrottleKey(email), ipThrottleKey(ip)} {
+		remaining, err := getLoginLockout(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if remaining > longest {
+			longest = remaining
+		}
+	}
+	return longest, nil
+}
+
+// registerLoginFailure counts the failure for both the email and the IP and audits new lockouts
+func registerLoginFailure(ctx context.Context, email string, ip string, accountID interface{}) {
+	// Failures are counted even if the client gives up on the request, or aborting requests would dodge the throttle
+	ctx = context.WithoutCancel(ctx)
+
+	limits := map[string]int{
+		emailThrottleKey(email): config.GetLoginMaxAttempts(),
+		ipThrottleKey(ip):       config.GetLoginMaxAttemptsPerIP(),
+	}
+
+	for key, maxAttempts := range limits {
+		duration, err := recordLoginFailure(ctx, key, maxAttempts)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to throttle login", "key", key, "error", err)
+			continue
+		}
+		if duration > 0 {
+			recordSecurityEvent(ctx, SecurityEventLockout, key, accountID, ip, nil, fmt.Sprintf("locked for %s", duration))
+		}
+	}
+}
+
+// clearLoginFailures resets the failure counter of an email after a successful login
+func clearLoginFailures(ctx context.Context, email string) {
+	if _, _, err := crud.Raw(ctx, "DELETE FROM login_throttle WHERE key = $1", emailThrottleKey(email)); err != nil {
+		slog.ErrorContext(ctx, "Failed to reset login failures", "email", email, "error", err)
+	}
+}
+
+// sendLockedResponse rejects a login attempt while the email or IP is locked out
+func sendLockedResponse(w http.ResponseWriter, remaining time.Duration) {
+	seconds := int(math.Ceil(remaining.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	response.SendResponse(w, http.StatusTooManyRequests, "Too many failed login attempts", fmt.Sprintf("try again in %d seconds", seconds), nil, false)
+}
+
+// GetAccountLockoutHandler shows the lockout state and lockout history of an account
+func GetAccountLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromVars(r, "id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
+		return
+	}
+
+	account, err := crud.Read(r.Context(), "account", id)
+	if err != nil {
+		sendLookupError(w, "Account not found", err)
+		return
+	}
+
+	key := emailThrottleKey(account.String("email"))
+	throttles, err := crud.List(r.Context(), "login_throttle", map[string]interface{}{"key": key})
+	if err != nil {
+		sendServerError(w, "Failed to retrieve lockout", err)
+		return
+	}
+
+	events, err := crud.List(r.Context(), "security_event", map[string]interface{}{"account_id": id})
+	if err != nil {
+		sendServerError(w, "Failed to retrieve security events", err)
+		return
+	}
+
+	var throttle crud.Row
+	if len(throttles) > 0 {
+		throttle = throttles[0]
+	}
+
+	response.SendResponse(w, http.StatusOK, "Lockout retrieved successfully", "", map[string]interface{}{
+		"throttle": throttle,
+		"events":   events,
+	}, false)
+}
+
+// ClearAccountLockoutHandler lifts the lockout of an account before it expires
+func ClearAccountLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	actorID, err := authz.AccountID(r)
+	if err != nil {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Account ID not found", err.Error(), nil, false)
+		return
+	}
+
+	id, err := getIDFromVars(r, "id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
+		return
+	}
+
+	account, err := crud.Read(r.Context(), "account", id)
+	if err != nil {
+		sendLookupError(w, "Account not found", err)
+		return
+	}
+
+	key := emailThrottleKey(account.String("email"))
+	_, cleared, err := crud.Raw(r.Context(), "DELETE FROM login_throttle WHERE key = $1", key)
+	if err != nil {
+		sendServerError(w, "Failed to clear lockout", err)
+		return
+	}
+
+	if cleared > 0 {
+		recordSecurityEvent(r.Context(), SecurityEventLockoutCleared, key, id, clientIP(r), actorID, "")
+	}
+
+	response.SendResponse(w, http.StatusOK, "Lockout cleared successfully", "", nil, false)
+}
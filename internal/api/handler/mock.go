@@ -1,29 +1,36 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/adolfooes/api_faker/config"
-	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/adolfooes/api_faker/internal/metrics"
+	"github.com/adolfooes/api_faker/internal/mockcache"
+	"github.com/adolfooes/api_faker/internal/repository"
+	"github.com/adolfooes/api_faker/internal/tracing"
 	"github.com/adolfooes/api_faker/pkg/utils/response"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// pathRegex allows alphanumeric characters, slashes (/), dashes (-), and underscores (_).
+// It is compiled once, as it runs on every mock request.
+var pathRegex = regexp.MustCompile(`^\/[a-zA-Z0-9\/\-_]*$`)
+
 func validatePath(path string) error {
 	if path == "" {
 		return fmt.Errorf("path is required")
 	}
 
-	// Regular expression to validate the path
-	// This regex allows alphanumeric characters, slashes (/), dashes (-), and underscores (_)
-	regex := regexp.MustCompile(`^\/[a-zA-Z0-9\/\-_]*$`)
-
-	if !regex.MatchString(path) {
+	if !pathRegex.MatchString(path) {
 		return fmt.Errorf("invalid path: path can only contain alphanumeric characters, slashes (/), dashes (-), and underscores (_)")
 	}
 
@@ -56,26 +63,36 @@ func validateProjectID(projectIDStr string) (int, error) {
 	return projectID, nil
 }
 
-func checkProjectOwnership(project map[string]interface{}, ownerID int64) error {
-	if project["owner_id"].(int64) != ownerID {
-		return fmt.Errorf("unauthorized: owner ID mismatch")
+func checkProjectOwnership(table *mockcache.Table, ownerID int64) error {
+	if table.OwnerID != ownerID {
+		return fmt.Errorf("owner ID mismatch: %w", repository.ErrNotFound)
 	}
 	return nil
 }
 
-func fetchProject(projectID int) (map[string]interface{}, error) {
-	filters := map[string]interface{}{
-		"id": projectID,
-	}
-	projectResults, err := crud.List("project", filters)
-	if err != nil || len(projectResults) == 0 {
+// fetchRouteTable returns the compiled routing table of the project
+func fetchRouteTable(ctx context.Context, projectID int) (*mockcache.Table, error) {
+	table, err := mockcache.Default().Get(ctx, int64(projectID))
+	if errors.Is(err, repository.ErrNotFound) {
 		return nil, fmt.Errorf("project not found")
 	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching project: %w", err)
+	}
 
-	return projectResults[0], nil
+	return table, nil
 }
 
 func MockHandler(w http.ResponseWriter, r *http.Request) {
+	// Record the response in the metrics, labelled once the project and URL config are known
+	start := time.Now()
+	recorder := metrics.NewResponseRecorder(w)
+	w = recorder
+	var projectLabel, urlConfigLabel string
+	defer func() {
+		metrics.ObserveMockRequest(projectLabel, urlConfigLabel, recorder.Status(), time.Since(start))
+	}()
+
 	// Extract the requested path from the URL
 	vars := mux.Vars(r)
 	path := "/" + vars["path"]
@@ -110,78 +127,122 @@ func MockHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch the project from the database
-	project, err := fetchProject(projectID)
+	// Trace the match of the request to a URL config, then the selection of its response.
+	// Attributes are only built for recorded spans, to keep untraced requests cheap.
+	ctx, matchSpan := tracing.Start(r.Context(), "mock.match")
+	// The span is ended once the route is matched, or here when the request stops before
+	matched := false
+	defer func() {
+		if !matched {
+			matchSpan.End()
+		}
+	}()
+	traced := matchSpan.IsRecording()
+	if traced {
+		matchSpan.SetAttributes(attribute.String("faker.project_id", projectIDStr), attribute.String("faker.path", path))
+	}
+
+	// Fetch the routing table of the project, compiled from the database when it isn't cached
+	table, err := fetchRouteTable(ctx, projectID)
 	if err != nil {
-		response.SendResponse(w, http.StatusNotFound, "Project not found", err.Error(), nil, false)
+		matchSpan.RecordError(err)
+		sendLookupError(w, "Project not found", err)
 		return
 	}
 
 	// Check ownership of the project
-	if err := checkProjectOwnership(project, ownerID); err != nil {
-		response.SendResponse(w, http.StatusUnauthorized, err.Error(), "", nil, false)
+	if err := checkProjectOwnership(table, ownerID); err != nil {
+		sendAuthorizationError(w, err)
 		return
 	}
+	projectLabel = table.ProjectLabel
 
-	// Check if the URL is configured in the database for the given project
-	method := strings.ToUpper(r.Method)
-	filters := map[string]interface{}{
-		"path":       path,
-		"method":     method,
-		"project_id": projectID, // Filter by the project ID from URL
+	// Projects requiring mTLS only answer clients with a verified certificate
+	if table.RequireClientCert {
+		if err := checkClientCertificate(r, table); err != nil {
+			response.SendResponse(w, http.StatusForbidden, err.Error(), "", nil, false)
+			return
+		}
 	}
-	urlConfigs, err := crud.List("url_config", filters)
-	if err != nil || len(urlConfigs) == 0 {
-		response.SendResponse(w, http.StatusNotFound, "URL not configured for mocking", "", nil, false)
+
+	// Projects can refuse protocols, to reproduce how clients behave when theirs isn't served
+	if !table.AllowsProtocol(requestProtocol(r)) {
+		response.SendResponse(w, http.StatusHTTPVersionNotSupported, "Protocol "+r.Proto+" is not enabled for the project", "", nil, false)
 		return
 	}
-	urlConfig := urlConfigs[0]
 
-	// Fetch all the HTTP statuses and their percentages from url_http_status for this url_config
-	filters = map[string]interface{}{
-		"url_id": urlConfig["id"],
+	// OIDC projects are served by the identity provider endpoints instead
+	if table.Type == ProjectTypeOIDC {
+		response.SendResponse(w, http.StatusNotFound, "Project is an OIDC project and has no mocked URLs", "", nil, false)
+		return
 	}
-	httpStatuses, err := crud.List("url_http_status", filters)
-	if err != nil || len(httpStatuses) == 0 {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to fetch HTTP statuses", err.Error(), nil, false)
+
+	// Check if the URL is configured for the given project
+	route := table.Route(strings.ToUpper(r.Method), path)
+	if route == nil {
+		response.SendResponse(w, http.StatusNotFound, "URL not configured for mocking", "", nil, false)
 		return
 	}
+	urlConfigLabel = route.URLLabel
+	if traced {
+		matchSpan.SetAttributes(attribute.Int64("faker.url_config_id", route.URLID))
+	}
+	matched = true
+	matchSpan.End()
 
-	// Randomize the response based on percentage
-	selectedStatus := randomizeHTTPStatus(httpStatuses)
+	_, selectSpan := tracing.Start(r.Context(), "mock.select")
+	defer selectSpan.End()
 
-	// Fetch the corresponding response model from the response_model table
-	filters = map[string]interface{}{
-		"url_http_status_id": selectedStatus["id"],
-	}
-	responseModels, err := crud.List("response_model", filters)
-	if err != nil || len(responseModels) == 0 {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to fetch response model", err.Error(), nil, false)
+	// Pick the variant the request is served from, if any
+	variant, err := resolveRequestVariant(r, table)
+	if err != nil {
+		selectSpan.RecordError(err)
+		response.SendResponse(w, http.StatusBadRequest, "Invalid variant", err.Error(), nil, false)
 		return
 	}
-	responseModel := responseModels[0]
 
-	// Send the mock response using the SendResponse function
-	response.SendResponse(w, int(selectedStatus["http_status"].(int64)), "", "", responseModel["model"], true)
-}
+	// Take the HTTP statuses and their percentages of the variant
+	var responses mockcache.Responses
+	if variant != nil {
+		w.Header().Set(VariantHeader, variant.Name)
+		if traced {
+			selectSpan.SetAttributes(attribute.String("faker.variant", variant.Name))
+		}
 
-// randomizeHTTPStatus selects a status based on the percentage distribution
-func randomizeHTTPStatus(statuses []map[string]interface{}) map[string]interface{} {
-	totalPercentage := 0
-	for _, status := range statuses {
-		totalPercentage += int(status["percentage"].(int64))
-	}
+		responses = route.Responses(variant)
 
-	randomNumber := rand.Intn(100) // Random number between 0 and 99
-	currentPercentage := 0
+		// URLs without statuses of their own in the variant serve its fallback response, if it has one
+		if variant.FallbackHTTPStatus != nil && responses.Empty() {
+			if traced {
+				selectSpan.SetAttributes(attribute.Bool("faker.fallback", true))
+			}
+			response.SendRaw(w, int(*variant.FallbackHTTPStatus), variant.FallbackBody)
+			return
+		}
+	}
 
-	for _, status := range statuses {
-		currentPercentage += int(status["percentage"].(int64))
-		if randomNumber < currentPercentage {
-			return status
+	// Without a variant, or when the variant doesn't override this URL, the default responses are served
+	if responses.Empty() {
+		responses = route.Responses(nil)
+		if responses.Empty() {
+			response.SendResponse(w, http.StatusInternalServerError, "Failed to fetch HTTP statuses", "the URL has no HTTP statuses", nil, false)
+			return
 		}
 	}
 
-	// Default to the first one if something goes wrong
-	return statuses[0]
+	// Randomize the response based on percentage
+	selected := responses.Pick(rand.Intn(100)) // Random number between 0 and 99
+	if traced {
+		selectSpan.SetAttributes(
+			attribute.Int64("faker.url_http_status_id", selected.StatusID),
+			attribute.Int("faker.http_status", selected.HTTPStatus),
+		)
+	}
+	if !selected.HasBody {
+		response.SendResponse(w, http.StatusInternalServerError, "Failed to fetch response model", "the HTTP status has no response model", nil, false)
+		return
+	}
+
+	// Send the pre-serialized mock response, with its early hints and trailers
+	sendMockResponse(w, r, table, selected)
 }
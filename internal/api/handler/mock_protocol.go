@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/adolfooes/api_faker/internal/mockcache"
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/adolfooes/api_faker/pkg/utils/response"
+	"golang.org/x/net/http/httpguts"
+)
+
+// Protocols a project can answer its mocks over
+const (
+	ProtocolHTTP1 = "http1" // HTTP/1.x, with or without TLS
+	ProtocolH2    = "h2"    // HTTP/2 over TLS
+	ProtocolH2C   = "h2c"   // HTTP/2 over cleartext connections
+)
+
+var knownProtocols = []string{ProtocolHTTP1, ProtocolH2, ProtocolH2C}
+
+// Limits of the protocol options of a status
+const (
+	maxTrailers   = 20
+	maxEarlyHints = 20
+)
+
+// forbiddenTrailers can't be sent as trailers: they frame the message, route or authenticate it, or are
+// needed before the body is processed
+var forbiddenTrailers = map[string]bool{
+	"Authorization": true, "Cache-Control": true, "Connection": true, "Content-Encoding": true,
+	"Content-Length": true, "Content-Range": true, "Content-Type": true, "Date": true, "Expect": true,
+	"Host": true, "Keep-Alive": true, "Location": true, "Max-Forwards": true, "Proxy-Authenticate": true,
+	"Proxy-Authorization": true, "Proxy-Connection": true, "Retry-After": true, "Set-Cookie": true,
+	"Te": true, "Trailer": true, "Transfer-Encoding": true, "Upgrade": true, "Vary": true,
+	"Www-Authenticate": true,
+}
+
+// ProjectProtocols selects the protocols the mocks of a project answer over, and whether the resources
+// preloaded by early hints are pushed over HTTP/2
+type ProjectProtocols struct {
+	Protocols  []string `json:"protocols"` // Every protocol when empty
+	ServerPush bool     `json:"server_push"`
+}
+
+func validateProjectProtocols(req ProjectProtocols) error {
+	for _, protocol := range req.Protocols {
+		if !slices.Contains(knownProtocols, protocol) {
+			return fmt.Errorf("unknown protocol %q, expected one of %s", protocol, strings.Join(knownProtocols, ", "))
+		}
+	}
+	return nil
+}
+
+// validateTrailers checks that the trailers of a status have valid names and values, and none of the
+// headers that can't be trailers
+func validateTrailers(trailers map[string]string) error {
+	if len(trailers) > maxTrailers {
+		return fmt.Errorf("a status cannot have more than %d trailers", maxTrailers)
+	}
+	for name, value := range trailers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("invalid trailer name %q", name)
+		}
+		if forbiddenTrailers[http.CanonicalHeaderKey(name)] {
+			return fmt.Errorf("%s cannot be sent as a trailer", http.CanonicalHeaderKey(name))
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("invalid value for trailer %s", name)
+		}
+	}
+	return nil
+}
+
+// validateEarlyHints checks that the early hints of a status are Link header values, e.g.
+// "</app.css>; rel=preload; as=style"
+func validateEarlyHints(links []string) error {
+	if len(links) > maxEarlyHints {
+		return fmt.Errorf("a status cannot have more than %d early hints", maxEarlyHints)
+	}
+	for _, link := range links {
+		if !strings.HasPrefix(link, "<") || !strings.Contains(link, ">") || !httpguts.ValidHeaderFieldValue(link) {
+			return fmt.Errorf("invalid early hint %q, expected a Link header value like </app.css>; rel=preload; as=style", link)
+		}
+	}
+	return nil
+}
+
+// protocolOptionValues returns the trailers and early hints of a status encoded for their JSONB columns,
+// nil when they are empty
+func protocolOptionValues(trailers map[string]string, earlyHints []string) (interface{}, interface{}) {
+	var encodedTrailers, encodedHints interface{}
+	if len(trailers) > 0 {
+		encoded, _ := json.Marshal(trailers)
+		encodedTrailers = string(encoded)
+	}
+	if len(earlyHints) > 0 {
+		encoded, _ := json.Marshal(earlyHints)
+		encodedHints = string(encoded)
+	}
+	return encodedTrailers, encodedHints
+}
+
+// requestProtocol returns the protocol a request was made over, as named by the project protocols
+func requestProtocol(r *http.Request) string {
+	switch {
+	case r.ProtoMajor < 2:
+		return ProtocolHTTP1
+	case r.TLS == nil:
+		return ProtocolH2C
+	default:
+		return ProtocolH2
+	}
+}
+
+// sendMockResponse writes the selected response of a mock. Its early hints are sent first in a 103
+// response, and pushed over HTTP/2 when the project asks for it. Its trailers are announced with the
+// headers and sent after the body, which makes HTTP/1.1 responses chunked.
+func sendMockResponse(w http.ResponseWriter, r *http.Request, table *mockcache.Table, selected mockcache.Response) {
+	header := w.Header()
+
+	if len(selected.EarlyHints) > 0 {
+		for _, link := range selected.EarlyHints {
+			header.Add("Link", link)
+		}
+		if table.ServerPush && r.ProtoMajor == 2 {
+			pushResources(w, r, selected.PushPaths)
+		}
+		// The links stay in the header map, so the final response carries them too
+		w.WriteHeader(http.StatusEarlyHints)
+	}
+
+	if len(selected.Trailers) == 0 {
+		response.SendRaw(w, selected.HTTPStatus, selected.Body)
+		return
+	}
+
+	for _, trailer := range selected.Trailers {
+		header.Add("Trailer", trailer.Name)
+	}
+	response.SendRaw(w, selected.HTTPStatus, selected.Body)
+	for _, trailer := range selected.Trailers {
+		header.Set(trailer.Name, trailer.Value)
+	}
+}
+
+// pushResources pushes the paths to the client, with the credentials of the request so the pushed mocks
+// are served like the request itself. Clients that refuse pushes get the early hints only.
+func pushResources(w http.ResponseWriter, r *http.Request, paths []string) {
+	pusher := findPusher(w)
+	if pusher == nil {
+		return
+	}
+
+	options := &http.PushOptions{Header: http.Header{}}
+	for _, name := range []string{"Authorization", "Cookie", VariantHeader} {
+		if value := r.Header.Get(name); value != "" {
+			options.Header.Set(name, value)
+		}
+	}
+
+	for _, path := range paths {
+		if err := pusher.Push(path, options); err != nil {
+			if !errors.Is(err, http.ErrNotSupported) {
+				slog.WarnContext(r.Context(), "Failed to push resource", "path", path, "error", err)
+			}
+			return
+		}
+	}
+}
+
+// findPusher returns the HTTP/2 pusher under the writers wrapping w, nil when the connection can't push
+func findPusher(w http.ResponseWriter) http.Pusher {
+	for {
+		if pusher, ok := w.(http.Pusher); ok {
+			return pusher
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// SetProjectProtocolsHandler selects the protocols the mocks of a project answer over, and whether early
+// hints are pushed over HTTP/2
+func SetProjectProtocolsHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ownerID, ok := requireProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var req ProjectProtocols
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+
+	if err := validateProjectProtocols(req); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Validation failed", err.Error(), nil, false)
+		return
+	}
+
+	// Every protocol is allowed when the list is empty, which is stored as NULL
+	var protocols interface{}
+	if len(req.Protocols) > 0 {
+		encoded, _ := json.Marshal(req.Protocols)
+		protocols = string(encoded)
+	}
+
+	updatedProject, err := crud.UpdateAudited(r.Context(), ownerID, "project", projectID, map[string]interface{}{
+		"protocols":   protocols,
+		"server_push": req.ServerPush,
+	})
+	if err != nil {
+		sendServerError(w, "Failed to update project protocols", err)
+		return
+	}
+
+	response.SendResponse(w, http.StatusOK, "Project protocols updated successfully", "", updatedProject, false)
+}
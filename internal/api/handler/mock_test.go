@@ -0,0 +1,224 @@
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/api/handler"
+	"github.com/adolfooes/api_faker/internal/mockcache"
+	"github.com/adolfooes/api_faker/internal/repository"
+	"github.com/gorilla/mux"
+)
+
+// baselinePath holds the published results of the mock handler benchmarks, in the format of go test -bench
+const baselinePath = "../../../benchmarks/mock_handler.txt"
+
+const (
+	benchProjectID = 1
+	benchOwnerID   = 1
+)
+
+// mockCase is a mock request replayed by the benchmarks, and the status it must be answered with
+type mockCase struct {
+	name   string
+	method string
+	target string
+	header http.Header
+	status int
+}
+
+var mockCases = []mockCase{
+	{name: "default", method: http.MethodGet, target: "/api/mock/1/users", status: http.StatusOK},
+	{name: "weighted", method: http.MethodPost, target: "/api/mock/1/orders", status: 0},
+	{name: "variant", method: http.MethodGet, target: "/api/mock/1/users", header: http.Header{handler.VariantHeader: {"degraded"}}, status: http.StatusServiceUnavailable},
+	{name: "fallback", method: http.MethodGet, target: "/api/mock/1/orders/latest", header: http.Header{handler.VariantHeader: {"degraded"}}, status: http.StatusInternalServerError},
+	{name: "large_body", method: http.MethodGet, target: "/api/mock/1/catalog", status: http.StatusOK},
+	{name: "not_found", method: http.MethodGet, target: "/api/mock/1/missing", status: http.StatusNotFound},
+}
+
+// BenchmarkMockHandler measures the hot path of the mock handler, serving compiled route tables from memory
+// without a database. Compare runs with benchstat, timings only compare well on the same machine.
+func BenchmarkMockHandler(b *testing.B) {
+	router := mockRouter()
+	for _, mc := range mockCases {
+		b.Run(mc.name, func(b *testing.B) {
+			request := mc.request(b)
+			w := newDiscardWriter()
+			b.ReportAllocs()
+			for b.Loop() {
+				router.ServeHTTP(w, request)
+			}
+		})
+	}
+}
+
+// TestMockHandlerAllocs fails when a mock request allocates more than in the published benchmark results.
+// Unlike timings, allocation counts do not depend on the machine.
+func TestMockHandlerAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not comparable with -race")
+	}
+	baseline, err := readAllocsBaseline(baselinePath)
+	if err != nil {
+		t.Fatalf("failed to read the benchmark results: %v", err)
+	}
+
+	router := mockRouter()
+	for _, mc := range mockCases {
+		t.Run(mc.name, func(t *testing.T) {
+			want, ok := baseline["BenchmarkMockHandler/"+mc.name]
+			if !ok {
+				t.Skip("no published result")
+			}
+			request := mc.request(t)
+			w := newDiscardWriter()
+			got := testing.AllocsPerRun(1000, func() {
+				router.ServeHTTP(w, request)
+			})
+			if got > float64(want) {
+				t.Errorf("%.0f allocs/op, was %d", got, want)
+			}
+		})
+	}
+}
+
+// request builds the request of the case, and checks it is answered as expected before it is measured
+func (mc mockCase) request(tb testing.TB) *http.Request {
+	tb.Helper()
+	request, err := http.NewRequest(mc.method, mc.target, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for name, values := range mc.header {
+		request.Header[name] = values
+	}
+	request = request.WithContext(context.WithValue(request.Context(), config.JWTAccountIDKey, fmt.Sprint(benchOwnerID)))
+
+	w := newDiscardWriter()
+	mockRouter().ServeHTTP(w, request)
+	if mc.status != 0 && w.status != mc.status {
+		tb.Fatalf("answered with %d instead of %d", w.status, mc.status)
+	}
+	return request
+}
+
+// readAllocsBaseline returns the allocs/op of each benchmark in the go test -bench output at path,
+// keeping the highest when a benchmark ran several times
+func readAllocsBaseline(path string) (map[string]int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	allocs := map[string]int64{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		// Drop the GOMAXPROCS suffix, e.g. BenchmarkMockHandler/default-8
+		name := fields[0]
+		if i := strings.LastIndex(name, "-"); i > 0 {
+			if _, err := strconv.Atoi(name[i+1:]); err == nil {
+				name = name[:i]
+			}
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			if fields[i+1] != "allocs/op" {
+				continue
+			}
+			value, err := strconv.ParseInt(fields[i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fields[0], err)
+			}
+			allocs[name] = max(allocs[name], value)
+		}
+	}
+	return allocs, scanner.Err()
+}
+
+// mockRouter serves the mock handler from the benchmark route table
+func mockRouter() http.Handler {
+	mockcache.Default().Put(benchTable())
+	router := mux.NewRouter()
+	router.HandleFunc("/api/mock/{project_id}/{path:.*}", handler.MockHandler)
+	return router
+}
+
+// benchTable returns the route table the benchmarks are served from
+func benchTable() *mockcache.Table {
+	degradedID := int64(2)
+	fallbackStatus := int64(http.StatusInternalServerError)
+
+	project := repository.Project{ID: benchProjectID, OwnerID: benchOwnerID, Name: "bench", Type: handler.ProjectTypeMock}
+	variants := []repository.ProjectVariant{
+		{ID: degradedID, ProjectID: benchProjectID, Name: "degraded", FallbackHTTPStatus: &fallbackStatus, FallbackModel: json.RawMessage(`{"error":"degraded"}`)},
+	}
+	urlConfigs := []repository.URLConfig{
+		{ID: 1, ProjectID: benchProjectID, Path: "/users", Method: http.MethodGet},
+		{ID: 2, ProjectID: benchProjectID, Path: "/orders", Method: http.MethodPost},
+		{ID: 3, ProjectID: benchProjectID, Path: "/orders/latest", Method: http.MethodGet},
+		{ID: 4, ProjectID: benchProjectID, Path: "/catalog", Method: http.MethodGet},
+	}
+	statuses := []repository.URLHTTPStatus{
+		{ID: 1, URLID: 1, HTTPStatus: http.StatusOK, Percentage: 100},
+		{ID: 2, URLID: 1, VariantID: &degradedID, HTTPStatus: http.StatusServiceUnavailable, Percentage: 100},
+		{ID: 3, URLID: 2, HTTPStatus: http.StatusCreated, Percentage: 80},
+		{ID: 4, URLID: 2, HTTPStatus: http.StatusConflict, Percentage: 15},
+		{ID: 5, URLID: 2, HTTPStatus: http.StatusInternalServerError, Percentage: 5},
+		{ID: 6, URLID: 3, HTTPStatus: http.StatusOK, Percentage: 100},
+		{ID: 7, URLID: 4, HTTPStatus: http.StatusOK, Percentage: 100},
+	}
+	models := []repository.ResponseModel{
+		{ID: 1, URLHTTPStatusID: 1, Model: json.RawMessage(`[{"id":1,"name":"Ada"},{"id":2,"name":"Grace"}]`)},
+		{ID: 2, URLHTTPStatusID: 2, Model: json.RawMessage(`{"error":"unavailable"}`)},
+		{ID: 3, URLHTTPStatusID: 3, Model: json.RawMessage(`{"id":10,"status":"created"}`)},
+		{ID: 4, URLHTTPStatusID: 4, Model: json.RawMessage(`{"error":"conflict"}`)},
+		{ID: 5, URLHTTPStatusID: 5, Model: json.RawMessage(`{"error":"boom"}`)},
+		{ID: 6, URLHTTPStatusID: 6, Model: json.RawMessage(`{"id":10}`)},
+		{ID: 7, URLHTTPStatusID: 7, Model: catalogModel(500)},
+	}
+
+	return mockcache.Compile(project, variants, urlConfigs, statuses, models)
+}
+
+// catalogModel returns a JSON array of n products, about 64 bytes each
+func catalogModel(n int) json.RawMessage {
+	products := make([]string, n)
+	for i := range products {
+		products[i] = fmt.Sprintf(`{"id":%d,"name":"Product %d","price":%d.99,"in_stock":true}`, i, i, i%100)
+	}
+	return json.RawMessage("[" + strings.Join(products, ",") + "]")
+}
+
+// discardWriter is a response writer that drops the body, so only the handler is measured
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+func newDiscardWriter() *discardWriter {
+	return &discardWriter{header: http.Header{}}
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(body []byte) (int, error) {
+	return len(body), nil
+}
+
+func (w *discardWriter) WriteHeader(status int) {
+	w.status = status
+}
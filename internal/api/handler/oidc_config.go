@@ -0,0 +1,385 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/adolfooes/api_faker/internal/api/authz"
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/adolfooes/api_faker/pkg/utils/response"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Project types supported by the faker
+const (
+	ProjectTypeMock = "mock"
+	ProjectTypeOIDC = "oidc"
+)
+
+// OIDCClient represents a client registered with a project's fake identity provider
+type OIDCClient struct {
+	ID           int64    `json:"id"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+// OIDCUser represents a user that can sign in to a project's fake identity provider
+type OIDCUser struct {
+	ID       int64                  `json:"id"`
+	Username string                 `json:"username"`
+	Password string                 `json:"password"`
+	Claims   map[string]interface{} `json:"claims"`
+}
+
+// reservedOIDCClaims can't be overridden by the configured user claims
+var reservedOIDCClaims = []string{"iss", "sub", "aud", "exp", "iat", "nbf", "auth_time", "nonce"}
+
+func validateProjectType(projectType string) error {
+	if projectType != ProjectTypeMock && projectType != ProjectTypeOIDC {
+		return fmt.Errorf("invalid project type: %s", projectType)
+	}
+	return nil
+}
+
+func validateRequiredOIDCClientFields(client OIDCClient) error {
+	if len(client.RedirectURIs) == 0 {
+		return fmt.Errorf("at least one redirect_uri is required")
+	}
+	for _, uri := range client.RedirectURIs {
+		if !strings.HasPrefix(uri, "http://") && !strings.HasPrefix(uri, "https://") {
+			return fmt.Errorf("invalid redirect_uri: %s", uri)
+		}
+	}
+	return nil
+}
+
+func validateRequiredOIDCUserFields(user OIDCUser) error {
+	if strings.TrimSpace(user.Username) == "" {
+		return fmt.Errorf("username is required")
+	}
+	if user.Password == "" {
+		return fmt.Errorf("password is required")
+	}
+	for _, claim := range reservedOIDCClaims {
+		if _, exists := user.Claims[claim]; exists {
+			return fmt.Errorf("claim %q is reserved and cannot be configured", claim)
+		}
+	}
+	return nil
+}
+
+// generateRandomToken returns a random hex string built from n random bytes
+func generateRandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// requireOIDCProjectOwner checks that the project in the path is an OIDC project owned by the caller.
+// It sends the error response itself and returns false when the request must stop.
+func requireOIDCProjectOwner(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	projectID, err := getIDFromVars(r, "id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid project ID", err.Error(), nil, false)
+		return 0, false
+	}
+
+	ownerID, err := authz.AccountID(r)
+	if err != nil {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Owner ID not found", err.Error(), nil, false)
+		return 0, false
+	}
+
+	project, err := crud.Read(r.Context(), "project", projectID)
+	if err != nil {
+		sendLookupError(w, "Project not found", err)
+		return 0, false
+	}
+
+	if err := authorizeProjectOwnership(r.Context(), projectID, ownerID); err != nil {
+		sendAuthorizationError(w, err)
+		return 0, false
+	}
+
+	if project["type"] != ProjectTypeOIDC {
+		response.SendResponse(w, http.StatusBadRequest, "Project is not an OIDC project", "", nil, false)
+		return 0, false
+	}
+
+	return projectID, true
+}
+
+// formatOIDCClient converts a database row into the API representation of a client
+func formatOIDCClient(row crud.Row) crud.Row {
+	row["redirect_uris"] = row.JSON("redirect_uris")
+	return row
+}
+
+// formatOIDCUser converts a database row into the API representation of a user
+func formatOIDCUser(row crud.Row) crud.Row {
+	row["password"] = nil
+	row["claims"] = row.JSON("claims")
+	return row
+}
+
+// CreateOIDCClientHandler registers a new client with the project's identity provider
+func CreateOIDCClientHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := requireOIDCProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var client OIDCClient
+	if err := json.NewDecoder(r.Body).Decode(&client); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+
+	if err := validateRequiredOIDCClientFields(client); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Validation failed", err.Error(), nil, false)
+		return
+	}
+
+	// Generate the credentials that were not provided
+	var err error
+	if client.ClientID == "" {
+		if client.ClientID, err = generateRandomToken(12); err != nil {
+			sendServerError(w, "Failed to generate client ID", err)
+			return
+		}
+	}
+	if client.ClientSecret == "" {
+		if client.ClientSecret, err = generateRandomToken(24); err != nil {
+			sendServerError(w, "Failed to generate client secret", err)
+			return
+		}
+	}
+
+	redirectURIs, err := json.Marshal(client.RedirectURIs)
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid redirect URIs", err.Error(), nil, false)
+		return
+	}
+
+	columns := []string{"project_id", "client_id", "client_secret", "redirect_uris"}
+	values := []interface{}{projectID, client.ClientID, client.ClientSecret, string(redirectURIs)}
+	createdClient, err := crud.Create(r.Context(), "oidc_client", columns, values)
+	if err != nil {
+		sendServerError(w, "Failed to create OIDC client", err)
+		return
+	}
+
+	response.SendResponse(w, http.StatusCreated, "OIDC client created successfully", "", formatOIDCClient(createdClient), false)
+}
+
+var oidcClientListSpec = listSpec{
+	table:       "oidc_client",
+	name:        "OIDC clients",
+	filterable:  []string{"client_id"},
+	sortable:    []string{"id", "client_id", "created_at"},
+	defaultSort: []crud.SortField{{Column: "id"}},
+	format:      formatOIDCClient,
+}
+
+// GetAllOIDCClientsHandler lists the clients registered with the project's identity provider
+func GetAllOIDCClientsHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := requireOIDCProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	sendList(w, r, oidcClientListSpec, map[string]interface{}{"project_id": projectID}, "OIDC clients retrieved successfully")
+}
+
+// DeleteOIDCClientHandler removes a client from the project's identity provider
+func DeleteOIDCClientHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := requireOIDCProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	clientID, err := getIDFromVars(r, "client_id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid client ID", err.Error(), nil, false)
+		return
+	}
+
+	clients, err := crud.List(r.Context(), "oidc_client", map[string]interface{}{"id": clientID, "project_id": projectID})
+	if err != nil || len(clients) == 0 {
+		response.SendResponse(w, http.StatusNotFound, "OIDC client not found", "", nil, false)
+		return
+	}
+
+	if err := crud.Delete(r.Context(), "oidc_client", clientID); err != nil {
+		sendServerError(w, "Failed to delete OIDC client", err)
+		return
+	}
+
+	response.SendResponse(w, http.StatusOK, "OIDC client deleted successfully", "", nil, false)
+}
+
+// CreateOIDCUserHandler adds a user to the project's identity provider
+func CreateOIDCUserHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := requireOIDCProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var user OIDCUser
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+	user.Username = strings.TrimSpace(user.Username)
+
+	if err := validateRequiredOIDCUserFields(user); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Validation failed", err.Error(), nil, false)
+		return
+	}
+
+	// Fake users sign in often during tests, so the default bcrypt cost is enough here
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		sendServerError(w, "Failed to hash password", err)
+		return
+	}
+
+	if user.Claims == nil {
+		user.Claims = map[string]interface{}{}
+	}
+	claims, err := json.Marshal(user.Claims)
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid claims", err.Error(), nil, false)
+		return
+	}
+
+	columns := []string{"project_id", "username", "password", "claims"}
+	values := []interface{}{projectID, user.Username, string(hashedPassword), string(claims)}
+	createdUser, err := crud.Create(r.Context(), "oidc_user", columns, values)
+	if err != nil {
+		sendServerError(w, "Failed to create OIDC user", err)
+		return
+	}
+
+	response.SendResponse(w, http.StatusCreated, "OIDC user created successfully", "", formatOIDCUser(createdUser), false)
+}
+
+var oidcUserListSpec = listSpec{
+	table:       "oidc_user",
+	name:        "OIDC users",
+	filterable:  []string{"username"},
+	sortable:    []string{"id", "username", "created_at"},
+	defaultSort: []crud.SortField{{Column: "id"}},
+	format:      formatOIDCUser,
+}
+
+// GetAllOIDCUsersHandler lists the users of the project's identity provider
+func GetAllOIDCUsersHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := requireOIDCProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	sendList(w, r, oidcUserListSpec, map[string]interface{}{"project_id": projectID}, "OIDC users retrieved successfully")
+}
+
+// UpdateOIDCUserHandler updates the password or claims of a user of the project's identity provider
+func UpdateOIDCUserHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := requireOIDCProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := getIDFromVars(r, "user_id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid user ID", err.Error(), nil, false)
+		return
+	}
+
+	users, err := crud.List(r.Context(), "oidc_user", map[string]interface{}{"id": userID, "project_id": projectID})
+	if err != nil || len(users) == 0 {
+		response.SendResponse(w, http.StatusNotFound, "OIDC user not found", "", nil, false)
+		return
+	}
+
+	var user OIDCUser
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+
+	// Only the provided fields are updated
+	updates := map[string]interface{}{}
+	if username := strings.TrimSpace(user.Username); username != "" {
+		updates["username"] = username
+	}
+	if user.Password != "" {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+		if err != nil {
+			sendServerError(w, "Failed to hash password", err)
+			return
+		}
+		updates["password"] = string(hashedPassword)
+	}
+	if user.Claims != nil {
+		for _, claim := range reservedOIDCClaims {
+			if _, exists := user.Claims[claim]; exists {
+				response.SendResponse(w, http.StatusBadRequest, "Validation failed", fmt.Sprintf("claim %q is reserved and cannot be configured", claim), nil, false)
+				return
+			}
+		}
+		claims, err := json.Marshal(user.Claims)
+		if err != nil {
+			response.SendResponse(w, http.StatusBadRequest, "Invalid claims", err.Error(), nil, false)
+			return
+		}
+		updates["claims"] = string(claims)
+	}
+
+	if len(updates) == 0 {
+		response.SendResponse(w, http.StatusBadRequest, "Nothing to update", "", nil, false)
+		return
+	}
+
+	updatedUser, err := crud.Update(r.Context(), "oidc_user", userID, updates)
+	if err != nil {
+		sendServerError(w, "Failed to update OIDC user", err)
+		return
+	}
+
+	response.SendResponse(w, http.StatusOK, "OIDC user updated successfully", "", formatOIDCUser(updatedUser), false)
+}
+
+// DeleteOIDCUserHandler removes a user from the project's identity provider
+func DeleteOIDCUserHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := requireOIDCProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := getIDFromVars(r, "user_id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid user ID", err.Error(), nil, false)
+		return
+	}
+
+	users, err := crud.List(r.Context(), "oidc_user", map[string]interface{}{"id": userID, "project_id": projectID})
+	if err != nil || len(users) == 0 {
+		response.SendResponse(w, http.StatusNotFound, "OIDC user not found", "", nil, false)
+		return
+	}
+
+	if err := crud.Delete(r.Context(), "oidc_user", userID); err != nil {
+		sendServerError(w, "Failed to delete OIDC user", err)
+		return
+	}
+
+	response.SendResponse(w, http.StatusOK, "OIDC user deleted successfully", "", nil, false)
+}
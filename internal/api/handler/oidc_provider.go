@@ -0,0 +1,651 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	oidcTokenTTL = 1 * time.Hour
+	oidcKeyBits  = 2048
+)
+
+// oidcLoginTemplate is the sign-in page served by the authorize endpoint
+var oidcLoginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>API Faker - Sign in</title></head>
+<body>
+<h1>Sign in</h1>
+{{if .Error}}<p style="color:red">{{.Error}}</p>{{end}}
+<form method="POST">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<label>Username <input type="text" name="username" autofocus></label><br>
+<label>Password <input type="password" name="password"></label><br>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// authorizeParams are the authorization request parameters carried through the login form
+var authorizeParams = []string{"client_id", "redirect_uri", "response_type", "scope", "state", "nonce", "code_challenge", "code_challenge_method"}
+
+// sendOAuthError writes an error in the format defined by RFC 6749
+func sendOAuthError(w http.ResponseWriter, statusCode int, code string, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// sendOAuthJSON writes a successful JSON response for the OIDC endpoints
+func sendOAuthJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(data)
+}
+
+// fetchOIDCProject loads the project from the path and makes sure it is an OIDC project
+func fetchOIDCProject(r *http.Request) (int64, error) {
+	projectID, err := getIDFromVars(r, "project_id")
+	if err != nil {
+		return 0, err
+	}
+
+	project, err := crud.Read(r.Context(), "project", projectID)
+	if err != nil {
+		return 0, fmt.Errorf("project not found")
+	}
+
+	if project["type"] != ProjectTypeOIDC {
+		return 0, fmt.Errorf("project is not an OIDC project")
+	}
+	if active, ok := project.NullBool("is_active"); ok && !active {
+		return 0, fmt.Errorf("project is not active")
+	}
+
+	return projectID, nil
+}
+
+// issuerURL builds the issuer of a project from the incoming request
+func issuerURL(r *http.Request, projectID int64) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/oidc/%d", scheme, r.Host, projectID)
+}
+
+// getProjectSigningKey returns the project's RSA signing key, generating it on first use
+func getProjectSigningKey(ctx context.Context, projectID int64) (*rsa.PrivateKey, string, error) {
+	keys, err := crud.List(ctx, "oidc_signing_key", map[string]interface{}{"project_id": projectID})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(keys) == 0 {
+		privateKey, err := rsa.GenerateKey(rand.Reader, oidcKeyBits)
+		if err != nil {
+			return nil, "", fmt.Errorf("error generating signing key: %w", err)
+		}
+
+		keyPEM := pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+		})
+
+		columns := []string{"project_id", "kid", "private_key"}
+		values := []interface{}{projectID, keyID(&privateKey.PublicKey), string(keyPEM)}
+		if _, err := crud.Create(ctx, "oidc_signing_key", columns, values); err != nil {
+			// Another request may have created the key concurrently, so read it back
+			keys, err = crud.List(ctx, "oidc_signing_key", map[string]interface{}{"project_id": projectID})
+			if err != nil || len(keys) == 0 {
+				return nil, "", fmt.Errorf("error storing signing key")
+			}
+		} else {
+			return privateKey, keyID(&privateKey.PublicKey), nil
+		}
+	}
+
+	keyPEM := keys[0].String("private_key")
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, "", fmt.Errorf("invalid signing key stored for project %d", projectID)
+	}
+
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("error parsing signing key: %w", err)
+	}
+
+	kid := keys[0].String("kid")
+	return privateKey, kid, nil
+}
+
+// keyID derives a stable key identifier from the public key
+func keyID(publicKey *rsa.PublicKey) string {
+	sum := sha256.Sum256(publicKey.N.Bytes())
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// fetchOIDCClient loads a client of the project by its client_id
+func fetchOIDCClient(ctx context.Context, projectID int64, clientID string) (crud.Row, []string, error) {
+	clients, err := crud.List(ctx, "oidc_client", map[string]interface{}{"project_id": projectID, "client_id": clientID})
+	if err != nil || len(clients) == 0 {
+		return nil, nil, fmt.Errorf("unknown client")
+	}
+
+	var redirectURIs []string
+	if raw := clients[0].JSON("redirect_uris"); raw != nil {
+		json.Unmarshal(raw, &redirectURIs)
+	}
+
+	return clients[0], redirectURIs, nil
+}
+
+// authenticateOIDCUser checks the username and password of a user of the project
+func authenticateOIDCUser(ctx context.Context, projectID int64, username string, password string) (crud.Row, error) {
+	users, err := crud.List(ctx, "oidc_user", map[string]interface{}{"project_id": projectID, "username": username})
+	if err != nil || len(users) == 0 {
+		return nil, fmt.Errorf("invalid username or password")
+	}
+
+	storedPassword := users[0].String("password")
+	if err := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(password)); err != nil {
+		return nil, fmt.Errorf("invalid username or password")
+	}
+
+	return users[0], nil
+}
+
+// authenticateOIDCClient checks the client credentials sent with HTTP Basic or in the form body
+func authenticateOIDCClient(r *http.Request, projectID int64, allowPublic bool) (string, error) {
+	clientID, clientSecret, hasBasic := r.BasicAuth()
+	if !hasBasic {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	client, _, err := fetchOIDCClient(r.Context(), projectID, clientID)
+	if err != nil {
+		return "", err
+	}
+
+	if clientSecret == "" && allowPublic {
+		return clientID, nil
+	}
+
+	storedSecret := client.String("client_secret")
+	if subtle.ConstantTimeCompare([]byte(storedSecret), []byte(clientSecret)) != 1 {
+		return "", fmt.Errorf("invalid client credentials")
+	}
+
+	return clientID, nil
+}
+
+// verifyCodeChallenge validates the PKCE code verifier against the stored challenge
+func verifyCodeChallenge(challenge string, method string, verifier string) bool {
+	if challenge == "" {
+		return true
+	}
+	if verifier == "" {
+		return false
+	}
+
+	if method == "S256" {
+		sum := sha256.Sum256([]byte(verifier))
+		return base64.RawURLEncoding.EncodeToString(sum[:]) == challenge
+	}
+	return verifier == challenge
+}
+
+// Token types set in the typ header, so an ID token can't be used as an access token (RFC 9068)
+const (
+	oidcAccessTokenType = "at+jwt"
+	oidcIDTokenType     = "JWT"
+)
+
+// Subject types of the access tokens, set in their subject_type claim: the subject is an OIDC user id
+// or, for the client_credentials grant, the client id
+const (
+	oidcSubjectUser   = "user"
+	oidcSubjectClient = "client"
+)
+
+// signOIDCToken signs the claims with the project's key, as a token of the given type
+func signOIDCToken(ctx context.Context, projectID int64, tokenType string, claims jwt.MapClaims) (string, error) {
+	privateKey, kid, err := getProjectSigningKey(ctx, projectID)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	token.Header["typ"] = tokenType
+	return token.SignedString(privateKey)
+}
+
+// issueOIDCTokens builds the token response for a user or, when user is nil, for the client itself
+func issueOIDCTokens(r *http.Request, projectID int64, clientID string, user crud.Row, scope string, nonce string) (map[string]interface{}, error) {
+	now := time.Now()
+	issuer := issuerURL(r, projectID)
+
+	subject, subjectType := clientID, oidcSubjectClient
+	if user != nil {
+		subject, subjectType = strconv.FormatInt(user.Int64("id"), 10), oidcSubjectUser
+	}
+
+	accessClaims := jwt.MapClaims{
+		"iss":          issuer,
+		"sub":          subject,
+		"subject_type": subjectType,
+		"aud":          clientID,
+		"client_id":    clientID,
+		"scope":        scope,
+		"iat":          now.Unix(),
+		"exp":          now.Add(oidcTokenTTL).Unix(),
+	}
+	accessToken, err := signOIDCToken(r.Context(), projectID, oidcAccessTokenType, accessClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(oidcTokenTTL.Seconds()),
+		"scope":        scope,
+	}
+
+	// The ID token is only issued for users that requested the openid scope
+	if user != nil && hasScope(scope, "openid") {
+		idClaims := jwt.MapClaims{}
+		if raw := user.JSON("claims"); raw != nil {
+			json.Unmarshal(raw, &idClaims)
+		}
+		idClaims["iss"] = issuer
+		idClaims["sub"] = subject
+		idClaims["aud"] = clientID
+		idClaims["iat"] = now.Unix()
+		idClaims["auth_time"] = now.Unix()
+		idClaims["exp"] = now.Add(oidcTokenTTL).Unix()
+		if nonce != "" {
+			idClaims["nonce"] = nonce
+		}
+
+		idToken, err := signOIDCToken(r.Context(), projectID, oidcIDTokenType, idClaims)
+		if err != nil {
+			return nil, err
+		}
+		tokens["id_token"] = idToken
+	}
+
+	return tokens, nil
+}
+
+func hasScope(scope string, wanted string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == wanted {
+			return true
+		}
+	}
+	return false
+}
+
+// OIDCDiscoveryHandler serves the OpenID Connect discovery document of a project
+func OIDCDiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := fetchOIDCProject(r)
+	if err != nil {
+		sendOAuthError(w, http.StatusNotFound, "invalid_request", err.Error())
+		return
+	}
+
+	issuer := issuerURL(r, projectID)
+	sendOAuthJSON(w, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+		"grant_types_supported":                 []string{"authorization_code", "password", "client_credentials"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+		"claims_supported":                      []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce"},
+	})
+}
+
+// OIDCJWKSHandler serves the public signing key of a project as a JSON Web Key Set
+func OIDCJWKSHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := fetchOIDCProject(r)
+	if err != nil {
+		sendOAuthError(w, http.StatusNotFound, "invalid_request", err.Error())
+		return
+	}
+
+	privateKey, kid, err := getProjectSigningKey(r.Context(), projectID)
+	if err != nil {
+		sendOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	publicKey := privateKey.PublicKey
+	sendOAuthJSON(w, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}},
+	})
+}
+
+// OIDCAuthorizeHandler shows the sign-in page and issues authorization codes
+func OIDCAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := fetchOIDCProject(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	params := map[string]string{}
+	for _, name := range authorizeParams {
+		if value := r.Form.Get(name); value != "" {
+			params[name] = value
+		}
+	}
+
+	// Errors before the redirect URI is validated must not redirect
+	_, redirectURIs, err := fetchOIDCClient(r.Context(), projectID, params["client_id"])
+	if err != nil {
+		http.Error(w, "Unknown client_id", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI := params["redirect_uri"]
+	validRedirect := false
+	for _, uri := range redirectURIs {
+		if uri == redirectURI {
+			validRedirect = true
+			break
+		}
+	}
+	if !validRedirect {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := target.Query()
+	if state := params["state"]; state != "" {
+		query.Set("state", state)
+	}
+
+	if params["response_type"] != "code" {
+		query.Set("error", "unsupported_response_type")
+		target.RawQuery = query.Encode()
+		http.Redirect(w, r, target.String(), http.StatusFound)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		oidcLoginTemplate.Execute(w, map[string]interface{}{"Params": params})
+		return
+	}
+
+	user, err := authenticateOIDCUser(r.Context(), projectID, r.PostForm.Get("username"), r.PostForm.Get("password"))
+	if err != nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusUnauthorized)
+		oidcLoginTemplate.Execute(w, map[string]interface{}{"Params": params, "Error": err.Error()})
+		return
+	}
+
+	code, err := generateRandomToken(32)
+	if err != nil {
+		http.Error(w, "Failed to generate authorization code", http.StatusInternalServerError)
+		return
+	}
+
+	// Codes are short-lived; the expiration is computed by the database clock
+	_, _, err = crud.Raw(r.Context(),
+		`INSERT INTO oidc_authorization_code (code, project_id, client_id, user_id, redirect_uri, scope, nonce, code_challenge, code_challenge_method, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW() + INTERVAL '5 minutes')`,
+		code, projectID, params["client_id"], user["id"], redirectURI, params["scope"], params["nonce"], params["code_challenge"], params["code_challenge_method"],
+	)
+	if err != nil {
+		http.Error(w, "Failed to store authorization code", http.StatusInternalServerError)
+		return
+	}
+
+	query.Set("code", code)
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// Failures of the authorization code grant that are answered differently
+var (
+	errInvalidAuthorizationCode = errors.New("invalid, expired or already used authorization code")
+	errOIDCClientAuthentication = errors.New("client authentication failed")
+)
+
+// OIDCTokenHandler exchanges grants for access and ID tokens
+func OIDCTokenHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := fetchOIDCProject(r)
+	if err != nil {
+		sendOAuthError(w, http.StatusNotFound, "invalid_request", err.Error())
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		sendOAuthError(w, http.StatusBadRequest, "invalid_request", "invalid form body")
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code := r.PostForm.Get("code")
+
+		// Codes are single use: the code is locked, the client authenticated, and only then the code deleted,
+		// so a request with a wrong secret doesn't burn it and concurrent requests wait and find it gone
+		var authCode crud.Row
+		var clientID string
+		err := crud.WithTx(r.Context(), func(tx *crud.Tx) error {
+			codes, _, err := tx.Raw("SELECT * FROM oidc_authorization_code WHERE code = $1 AND project_id = $2 AND expires_at > NOW() FOR UPDATE", code, projectID)
+			if err != nil {
+				return err
+			}
+			if len(codes) == 0 {
+				return errInvalidAuthorizationCode
+			}
+			authCode = codes[0]
+
+			clientID, err = authenticateOIDCClient(r, projectID, authCode.String("code_challenge") != "")
+			if err != nil || clientID != authCode["client_id"] {
+				return errOIDCClientAuthentication
+			}
+
+			_, _, err = tx.Raw("DELETE FROM oidc_authorization_code WHERE code = $1", code)
+			return err
+		})
+		if errors.Is(err, errOIDCClientAuthentication) {
+			sendOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+			return
+		}
+		if err != nil {
+			sendOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid, expired or already used authorization code")
+			return
+		}
+
+		challenge := authCode.String("code_challenge")
+		method := authCode.String("code_challenge_method")
+
+		if r.PostForm.Get("redirect_uri") != authCode["redirect_uri"] {
+			sendOAuthError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri mismatch")
+			return
+		}
+
+		if !verifyCodeChallenge(challenge, method, r.PostForm.Get("code_verifier")) {
+			sendOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid code_verifier")
+			return
+		}
+
+		user, err := crud.Read(r.Context(), "oidc_user", authCode.Int64("user_id"))
+		if err != nil {
+			sendOAuthError(w, http.StatusBadRequest, "invalid_grant", "user no longer exists")
+			return
+		}
+
+		scope := authCode.String("scope")
+		nonce := authCode.String("nonce")
+		tokens, err := issueOIDCTokens(r, projectID, clientID, user, scope, nonce)
+		if err != nil {
+			sendOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+		sendOAuthJSON(w, tokens)
+
+	case "password":
+		clientID, err := authenticateOIDCClient(r, projectID, false)
+		if err != nil {
+			sendOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+			return
+		}
+
+		user, err := authenticateOIDCUser(r.Context(), projectID, r.PostForm.Get("username"), r.PostForm.Get("password"))
+		if err != nil {
+			sendOAuthError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+			return
+		}
+
+		tokens, err := issueOIDCTokens(r, projectID, clientID, user, r.PostForm.Get("scope"), "")
+		if err != nil {
+			sendOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+		sendOAuthJSON(w, tokens)
+
+	case "client_credentials":
+		clientID, err := authenticateOIDCClient(r, projectID, false)
+		if err != nil {
+			sendOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+			return
+		}
+
+		tokens, err := issueOIDCTokens(r, projectID, clientID, nil, r.PostForm.Get("scope"), "")
+		if err != nil {
+			sendOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+		sendOAuthJSON(w, tokens)
+
+	default:
+		sendOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code, password or client_credentials")
+	}
+}
+
+// OIDCUserInfoHandler returns the claims of the user the access token was issued for
+func OIDCUserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := fetchOIDCProject(r)
+	if err != nil {
+		sendOAuthError(w, http.StatusNotFound, "invalid_request", err.Error())
+		return
+	}
+
+	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if tokenString == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		sendOAuthError(w, http.StatusUnauthorized, "invalid_token", "access token missing")
+		return
+	}
+
+	privateKey, _, err := getProjectSigningKey(r.Context(), projectID)
+	if err != nil {
+		sendOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	// Only access tokens are accepted, ID tokens are signed with the same key but have another type
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); !strings.EqualFold(typ, oidcAccessTokenType) {
+			return nil, fmt.Errorf("token is not an access token")
+		}
+		return &privateKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer(issuerURL(r, projectID)))
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		sendOAuthError(w, http.StatusUnauthorized, "invalid_token", "invalid access token")
+		return
+	}
+
+	// Client credential tokens have the client id as subject, which may look like a user id
+	if subjectType, _ := claims["subject_type"].(string); subjectType != oidcSubjectUser {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		sendOAuthError(w, http.StatusUnauthorized, "invalid_token", "access token was not issued for a user")
+		return
+	}
+
+	subject, _ := claims["sub"].(string)
+	userID, err := strconv.ParseInt(subject, 10, 64)
+	if err != nil {
+		sendOAuthError(w, http.StatusUnauthorized, "invalid_token", "access token was not issued for a user")
+		return
+	}
+
+	users, err := crud.List(r.Context(), "oidc_user", map[string]interface{}{"id": userID, "project_id": projectID})
+	if err != nil || len(users) == 0 {
+		sendOAuthError(w, http.StatusUnauthorized, "invalid_token", "user no longer exists")
+		return
+	}
+
+	userInfo := map[string]interface{}{}
+	if raw := users[0].JSON("claims"); raw != nil {
+		json.Unmarshal(raw, &userInfo)
+	}
+	userInfo["sub"] = subject
+	if _, exists := userInfo["preferred_username"]; !exists {
+		userInfo["preferred_username"] = users[0]["username"]
+	}
+
+	sendOAuthJSON(w, userInfo)
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/api/authz"
+	"github.com/adolfooes/api_faker/internal/repository"
 	"github.com/adolfooes/api_faker/pkg/utils/crud"
 	"github.com/adolfooes/api_faker/pkg/utils/response"
 	"github.com/gorilla/mux"
@@ -20,6 +23,7 @@ type Project struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	OwnerID     int64  `json:"owner_id"` // Changed AccountID to OwnerID
+	Type        string `json:"type"`     // Either "mock" or "oidc"
 }
 
 func validateRequiredProjectFields(project Project) error {
@@ -32,12 +36,12 @@ func validateRequiredProjectFields(project Project) error {
 	return nil
 }
 
-func validateProjectOwnership(projectID int, ownerID int64) (bool, error) {
+func validateProjectOwnership(ctx context.Context, projectID int, ownerID int64) (bool, error) {
 	filters := map[string]interface{}{
 		"id":       projectID,
 		"owner_id": ownerID,
 	}
-	projects, err := crud.List("project", filters)
+	projects, err := crud.List(ctx, "project", filters)
 	if err != nil {
 		return false, err
 	}
@@ -85,6 +89,15 @@ func CreateProjectHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Projects are plain mocks unless another type is requested
+	if project.Type == "" {
+		project.Type = ProjectTypeMock
+	}
+	if err := validateProjectType(project.Type); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Project type validation failed", err.Error(), nil, false)
+		return
+	}
+
 	// Extract the account ID (which will be used as owner_id) from the context (injected by the JWT middleware)
 	ownerIDStr, ok := r.Context().Value(config.JWTAccountIDKey).(string)
 	if !ok {
@@ -103,11 +116,11 @@ func CreateProjectHandler(w http.ResponseWriter, r *http.Request) {
 	project.OwnerID = ownerID
 
 	// Insert the new project into the database, including the owner ID
-	columns := []string{"name", "description", "owner_id"} // Updated to use owner_id
-	values := []interface{}{project.Name, project.Description, ownerID}
-	createdProject, err := crud.Create("project", columns, values) // Fetching the created project object
+	columns := []string{"name", "description", "owner_id", "type"} // Updated to use owner_id
+	values := []interface{}{project.Name, project.Description, ownerID, project.Type}
+	createdProject, err := crud.CreateAudited(r.Context(), ownerID, "project", columns, values) // Fetching the created project object
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to create project", err.Error(), nil, false)
+		sendServerError(w, "Failed to create project", err)
 		return
 	}
 
@@ -115,16 +128,18 @@ func CreateProjectHandler(w http.ResponseWriter, r *http.Request) {
 	response.SendResponse(w, http.StatusCreated, "Project created successfully", "", createdProject, false)
 }
 
+var projectListSpec = listSpec{
+	table:       "project",
+	name:        "projects",
+	filterable:  []string{"name", "type", "is_active", "owner_id"},
+	sortable:    []string{"id", "name", "created_at", "updated_at"},
+	defaultSort: []crud.SortField{{Column: "id"}},
+	scoped:      true,
+}
+
 // GetAllProjectsHandler retrieves all projects from the database
 func GetAllProjectsHandler(w http.ResponseWriter, r *http.Request) {
-	filters := map[string]interface{}{} // No filters, get all projects
-	results, err := crud.List("project", filters)
-	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to retrieve projects", err.Error(), nil, false)
-		return
-	}
-
-	response.SendResponse(w, http.StatusOK, "Projects retrieved successfully", "", results, false)
+	sendList(w, r, projectListSpec, nil, "Projects retrieved successfully")
 }
 
 // GetProjectHandler retrieves a single project by ID from the database
@@ -144,10 +159,16 @@ func GetProjectHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Query the database for the project by ID
-	result, err := crud.Read("project", id)
+	accountID, err := authz.AccountID(r)
+	if err != nil {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Account ID not found", err.Error(), nil, false)
+		return
+	}
+
+	// Query the database for the project by ID, if the caller owns it or is a member
+	result, err := authz.ReadScoped(r.Context(), accountID, "project", id)
 	if err != nil {
-		response.SendResponse(w, http.StatusNotFound, "Failed to retrieve project", err.Error(), nil, false)
+		sendLookupError(w, "Failed to retrieve project", err)
 		return
 	}
 
@@ -164,17 +185,16 @@ func UpdateProjectHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate project ID from URL
-	idStr := r.URL.Query().Get("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil || id <= 0 {
+	id, err := getIDFromVars(r, "id")
+	if err != nil {
 		response.SendResponse(w, http.StatusBadRequest, "Invalid project ID", err.Error(), nil, false)
 		return
 	}
 
 	// Query the project by ID
-	_, err = crud.Read("project", id)
+	_, err = crud.Read(r.Context(), "project", id)
 	if err != nil {
-		response.SendResponse(w, http.StatusNotFound, "Project not found", err.Error(), nil, false)
+		sendLookupError(w, "Project not found", err)
 		return
 	}
 
@@ -193,8 +213,8 @@ func UpdateProjectHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate that the project belongs to the owner
-	if err := authorizeProjectOwnership(project.ID, ownerID); err != nil {
-		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: "+err.Error(), "", nil, false)
+	if err := authorizeProjectOwnership(r.Context(), id, ownerID); err != nil {
+		sendAuthorizationError(w, err)
 		return
 	}
 
@@ -203,9 +223,9 @@ func UpdateProjectHandler(w http.ResponseWriter, r *http.Request) {
 		"name":        project.Name,
 		"description": project.Description,
 	}
-	updatedProject, err := crud.Update("project", project.ID, updates) // Fetching the updated project object
+	updatedProject, err := crud.UpdateAudited(r.Context(), ownerID, "project", id, updates) // Fetching the updated project object
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to update project", err.Error(), nil, false)
+		sendServerError(w, "Failed to update project", err)
 		return
 	}
 
@@ -214,17 +234,16 @@ func UpdateProjectHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteProjectHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := getIDFromVars(r, "id")
 	if err != nil {
 		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
 		return
 	}
 
 	// Query the project by ID
-	_, err = crud.Read("project", id)
+	_, err = crud.Read(r.Context(), "project", id)
 	if err != nil {
-		response.SendResponse(w, http.StatusNotFound, "Project not found", err.Error(), nil, false)
+		sendLookupError(w, "Project not found", err)
 		return
 	}
 
@@ -243,15 +262,15 @@ func DeleteProjectHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate that the project belongs to the owner
-	if err := authorizeProjectOwnership(id, ownerID); err != nil {
-		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: "+err.Error(), "", nil, false)
+	if err := authorizeProjectOwnership(r.Context(), id, ownerID); err != nil {
+		sendAuthorizationError(w, err)
 		return
 	}
 
 	// Perform the deletion
-	err = crud.Delete("project", id)
+	err = crud.DeleteAudited(r.Context(), ownerID, "project", id)
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to delete project", err.Error(), nil, false)
+		sendServerError(w, "Failed to delete project", err)
 		return
 	}
 
@@ -259,20 +278,65 @@ func DeleteProjectHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // authorizeProjectOwnership validates if the current user owns the project.
-func authorizeProjectOwnership(projectID int64, ownerID int64) error {
-	filters := map[string]interface{}{
-		"id":       projectID,
-		"owner_id": ownerID,
+func authorizeProjectOwnership(ctx context.Context, projectID int64, ownerID int64) error {
+	_, err := repository.Default().GetOwnedProject(ctx, projectID, ownerID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("you are not authorized to perform this operation on the project: %w", err)
 	}
+	return err
+}
 
-	projects, err := crud.List("project", filters)
+// CloneProjectRequest optionally names the copy of a project
+type CloneProjectRequest struct {
+	Name string `json:"name"`
+}
+
+// CloneProjectHandler deep-copies a project with all its mocked URLs into a new project owned by the caller
+func CloneProjectHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromVars(r, "id")
 	if err != nil {
-		return err
+		response.SendResponse(w, http.StatusBadRequest, "Invalid project ID", err.Error(), nil, false)
+		return
 	}
 
-	if len(projects) == 0 {
-		return errors.New("you are not authorized to perform this operation on the project")
+	ownerID, err := authz.AccountID(r)
+	if err != nil {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Owner ID not found", err.Error(), nil, false)
+		return
 	}
 
-	return nil
+	// Any project the caller can read may be forked: their own, a team's they are an active member of, or any for admins
+	project, err := authz.ReadScoped(r.Context(), ownerID, "project", id)
+	if err != nil {
+		sendLookupError(w, "Project not found", err)
+		return
+	}
+
+	// The body is optional, the copy is named after the original by default
+	var req CloneProjectRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+			return
+		}
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		req.Name = fmt.Sprintf("%s (copy)", project["name"])
+	}
+	if err := validateRequiredProjectFields(Project{Name: req.Name}); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Required fields validation failed", err.Error(), nil, false)
+		return
+	}
+
+	// The OIDC clients and users hold secrets only the owner can read, so only the owner's copy gets them.
+	// Their secrets are identical in the copy and would get tokens from the original issuer.
+	withOIDC := project.Int64("owner_id") == ownerID
+	clonedProject, err := crud.CloneProject(r.Context(), ownerID, id, req.Name, withOIDC)
+	if err != nil {
+		sendServerError(w, "Failed to clone project", err)
+		return
+	}
+
+	response.SendResponse(w, http.StatusCreated, "Project cloned successfully", "", clonedProject, false)
 }
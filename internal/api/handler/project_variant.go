@@ -0,0 +1,403 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/adolfooes/api_faker/internal/api/authz"
+	"github.com/adolfooes/api_faker/internal/db"
+	"github.com/adolfooes/api_faker/internal/mockcache"
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/adolfooes/api_faker/pkg/utils/response"
+)
+
+// Ways a client can select a variant of a mocked project for one request
+const (
+	VariantHeader     = "X-Faker-Variant"
+	VariantQueryParam = "_variant"
+)
+
+// ProjectVariant is a named set of responses of a project, such as "happy path" or "everything 500s"
+type ProjectVariant struct {
+	ID                 int64       `json:"id"`
+	ProjectID          int64       `json:"project_id"`
+	Name               string      `json:"name"`
+	Description        string      `json:"description"`
+	FallbackHTTPStatus *int        `json:"fallback_http_status"` // Served by URLs without statuses in the variant
+	FallbackModel      interface{} `json:"fallback_model"`
+	ClientSubject      string      `json:"client_subject"` // Served to the clients whose certificate has the subject, over TLS
+}
+
+// ActiveVariantRequest selects the variant a project serves by default, or the default responses when empty
+type ActiveVariantRequest struct {
+	VariantID *int64 `json:"variant_id"`
+}
+
+func validateRequiredProjectVariantFields(variant ProjectVariant) error {
+	if variant.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(variant.Name) > 100 {
+		return fmt.Errorf("name cannot be longer than 100 characters")
+	}
+	if len(variant.ClientSubject) > 255 {
+		return fmt.Errorf("client subject cannot be longer than 255 characters")
+	}
+	if variant.FallbackHTTPStatus != nil {
+		if err := validateHTTPStatusCode(*variant.FallbackHTTPStatus); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDuplicateProjectVariant reports whether another variant of the project already has the name
+func checkDuplicateProjectVariant(ctx context.Context, projectID int64, name string, excludeID int64) (bool, error) {
+	return checkOtherProjectVariant(ctx, map[string]interface{}{"project_id": projectID, "name": name}, excludeID)
+}
+
+// checkDuplicateClientSubject reports whether another variant of the project is already served to the client subject
+func checkDuplicateClientSubject(ctx context.Context, projectID int64, subject string, excludeID int64) (bool, error) {
+	if subject == "" {
+		return false, nil
+	}
+	return checkOtherProjectVariant(ctx, map[string]interface{}{"project_id": projectID, "client_subject": subject}, excludeID)
+}
+
+// checkOtherProjectVariant reports whether a variant other than excludeID matches the filters
+func checkOtherProjectVariant(ctx context.Context, filters map[string]interface{}, excludeID int64) (bool, error) {
+	variants, err := crud.List(ctx, "project_variant", filters)
+	if err != nil {
+		return false, err
+	}
+	for _, variant := range variants {
+		if variant.Int64("id") != excludeID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// findProjectVariant returns the variant of the project with the given id, or an error if it has none
+func findProjectVariant(ctx context.Context, projectID int64, variantID int64) (crud.Row, error) {
+	variants, err := crud.List(ctx, "project_variant", map[string]interface{}{"id": variantID, "project_id": projectID})
+	if err != nil {
+		return nil, err
+	}
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("variant %d not found in project %d", variantID, projectID)
+	}
+	return variants[0], nil
+}
+
+// resolveRequestVariant returns the variant a mock request is served from: the one selected by the
+// request header or query parameter, else the one of the subject of the client certificate, else the
+// project's active variant. It returns nil for the default responses.
+func resolveRequestVariant(r *http.Request, table *mockcache.Table) (*mockcache.Variant, error) {
+	name := strings.TrimSpace(r.Header.Get(VariantHeader))
+	if name == "" && r.URL.RawQuery != "" {
+		name = strings.TrimSpace(r.URL.Query().Get(VariantQueryParam))
+	}
+
+	if name != "" {
+		variant := table.VariantByName(name)
+		if variant == nil {
+			return nil, fmt.Errorf("variant %q not found in project %d", name, table.ProjectID)
+		}
+		return variant, nil
+	}
+
+	// A certificate issued for another project doesn't select the variants of this one, even with the same subject
+	if cert := verifiedClientCertificate(r); cert != nil && certificateMatchesProject(cert, table.ProjectID) {
+		if variant := table.VariantByClientSubject(cert.Subject); variant != nil {
+			return variant, nil
+		}
+	}
+
+	if table.ActiveVariantID == nil {
+		return nil, nil
+	}
+	variant := table.Variant(*table.ActiveVariantID)
+	if variant == nil {
+		return nil, fmt.Errorf("variant %d not found in project %d", *table.ActiveVariantID, table.ProjectID)
+	}
+	return variant, nil
+}
+
+// formatProjectVariant converts a database row into the API representation of a variant
+func formatProjectVariant(row crud.Row) crud.Row {
+	row["fallback_model"] = row.JSON("fallback_model")
+	return row
+}
+
+// projectVariantValues returns the columns stored for a variant, with the fallback model encoded for JSONB
+func projectVariantValues(variant ProjectVariant) (map[string]interface{}, error) {
+	var fallbackModel interface{}
+	if variant.FallbackModel != nil {
+		encoded, err := json.Marshal(variant.FallbackModel)
+		if err != nil {
+			return nil, err
+		}
+		fallbackModel = string(encoded)
+	}
+
+	// Variants without a subject are stored as NULL, which the unique constraint lets repeat
+	var clientSubject interface{}
+	if variant.ClientSubject != "" {
+		clientSubject = variant.ClientSubject
+	}
+
+	return map[string]interface{}{
+		"name":                 variant.Name,
+		"description":          variant.Description,
+		"fallback_http_status": variant.FallbackHTTPStatus,
+		"fallback_model":       fallbackModel,
+		"client_subject":       clientSubject,
+	}, nil
+}
+
+// projectVariantClientSubjectKey is the unique constraint on the client subjects of the variants of a project
+const projectVariantClientSubjectKey = "project_variant_client_subject_key"
+
+// sendProjectVariantWriteError answers a failed write of a variant. A concurrent write can take the name or
+// client subject after the duplicate checks, the unique constraints then refuse it with 409 like the checks.
+func sendProjectVariantWriteError(w http.ResponseWriter, message string, err error) {
+	if !db.IsUniqueViolation(err) {
+		sendServerError(w, message, err)
+		return
+	}
+	if db.ViolatedConstraint(err) == projectVariantClientSubjectKey {
+		response.SendResponse(w, http.StatusConflict, "Another variant is already served to the client subject", "", nil, false)
+		return
+	}
+	response.SendResponse(w, http.StatusConflict, "Variant with the same name already exists", "", nil, false)
+}
+
+// requireProjectOwner checks that the project in the path is owned by the caller.
+// It sends the error response itself and returns false when the request must stop.
+func requireProjectOwner(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	projectID, err := getIDFromVars(r, "id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid project ID", err.Error(), nil, false)
+		return 0, 0, false
+	}
+
+	ownerID, err := authz.AccountID(r)
+	if err != nil {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Owner ID not found", err.Error(), nil, false)
+		return 0, 0, false
+	}
+
+	if _, err := crud.Read(r.Context(), "project", projectID); err != nil {
+		sendLookupError(w, "Project not found", err)
+		return 0, 0, false
+	}
+
+	if err := authorizeProjectOwnership(r.Context(), projectID, ownerID); err != nil {
+		sendAuthorizationError(w, err)
+		return 0, 0, false
+	}
+
+	return projectID, ownerID, true
+}
+
+// CreateProjectVariantHandler adds a named variant to a project
+func CreateProjectVariantHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ownerID, ok := requireProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var variant ProjectVariant
+	if err := json.NewDecoder(r.Body).Decode(&variant); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+	variant.Name = strings.TrimSpace(variant.Name)
+	variant.ClientSubject = strings.TrimSpace(variant.ClientSubject)
+
+	if err := validateRequiredProjectVariantFields(variant); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Validation failed", err.Error(), nil, false)
+		return
+	}
+
+	exists, err := checkDuplicateProjectVariant(r.Context(), projectID, variant.Name, 0)
+	if err != nil {
+		sendServerError(w, "Error checking duplicate variant", err)
+		return
+	}
+	if exists {
+		response.SendResponse(w, http.StatusConflict, "Variant with the same name already exists", "", nil, false)
+		return
+	}
+
+	exists, err = checkDuplicateClientSubject(r.Context(), projectID, variant.ClientSubject, 0)
+	if err != nil {
+		sendServerError(w, "Error checking duplicate client subject", err)
+		return
+	}
+	if exists {
+		response.SendResponse(w, http.StatusConflict, "Another variant is already served to the client subject", "", nil, false)
+		return
+	}
+
+	values, err := projectVariantValues(variant)
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid fallback model", err.Error(), nil, false)
+		return
+	}
+
+	columns := []string{"project_id", "name", "description", "fallback_http_status", "fallback_model", "client_subject"}
+	createdVariant, err := crud.CreateAudited(r.Context(), ownerID, "project_variant", columns, []interface{}{
+		projectID, values["name"], values["description"], values["fallback_http_status"], values["fallback_model"], values["client_subject"],
+	})
+	if err != nil {
+		sendProjectVariantWriteError(w, "Failed to create variant", err)
+		return
+	}
+
+	response.SendResponse(w, http.StatusCreated, "Variant created successfully", "", formatProjectVariant(createdVariant), false)
+}
+
+var projectVariantListSpec = listSpec{
+	table:       "project_variant",
+	name:        "variants",
+	filterable:  []string{"name"},
+	sortable:    []string{"id", "name", "created_at", "updated_at"},
+	defaultSort: []crud.SortField{{Column: "id"}},
+	format:      formatProjectVariant,
+}
+
+// GetAllProjectVariantsHandler lists the variants of a project
+func GetAllProjectVariantsHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, _, ok := requireProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	sendList(w, r, projectVariantListSpec, map[string]interface{}{"project_id": projectID}, "Variants retrieved successfully")
+}
+
+// UpdateProjectVariantHandler updates the name, description, fallback response or client subject of a variant
+func UpdateProjectVariantHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ownerID, ok := requireProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	variantID, err := getIDFromVars(r, "variant_id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid variant ID", err.Error(), nil, false)
+		return
+	}
+
+	if _, err := findProjectVariant(r.Context(), projectID, variantID); err != nil {
+		sendLookupError(w, "Variant not found", err)
+		return
+	}
+
+	var variant ProjectVariant
+	if err := json.NewDecoder(r.Body).Decode(&variant); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+	variant.Name = strings.TrimSpace(variant.Name)
+	variant.ClientSubject = strings.TrimSpace(variant.ClientSubject)
+
+	if err := validateRequiredProjectVariantFields(variant); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Validation failed", err.Error(), nil, false)
+		return
+	}
+
+	exists, err := checkDuplicateProjectVariant(r.Context(), projectID, variant.Name, variantID)
+	if err != nil {
+		sendServerError(w, "Error checking duplicate variant", err)
+		return
+	}
+	if exists {
+		response.SendResponse(w, http.StatusConflict, "Variant with the same name already exists", "", nil, false)
+		return
+	}
+
+	exists, err = checkDuplicateClientSubject(r.Context(), projectID, variant.ClientSubject, variantID)
+	if err != nil {
+		sendServerError(w, "Error checking duplicate client subject", err)
+		return
+	}
+	if exists {
+		response.SendResponse(w, http.StatusConflict, "Another variant is already served to the client subject", "", nil, false)
+		return
+	}
+
+	updates, err := projectVariantValues(variant)
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid fallback model", err.Error(), nil, false)
+		return
+	}
+
+	updatedVariant, err := crud.UpdateAudited(r.Context(), ownerID, "project_variant", variantID, updates)
+	if err != nil {
+		sendProjectVariantWriteError(w, "Failed to update variant", err)
+		return
+	}
+
+	response.SendResponse(w, http.StatusOK, "Variant updated successfully", "", formatProjectVariant(updatedVariant), false)
+}
+
+// DeleteProjectVariantHandler removes a variant together with the statuses defined for it
+func DeleteProjectVariantHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ownerID, ok := requireProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	variantID, err := getIDFromVars(r, "variant_id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid variant ID", err.Error(), nil, false)
+		return
+	}
+
+	if _, err := findProjectVariant(r.Context(), projectID, variantID); err != nil {
+		sendLookupError(w, "Variant not found", err)
+		return
+	}
+
+	if err := crud.DeleteAudited(r.Context(), ownerID, "project_variant", variantID); err != nil {
+		sendServerError(w, "Failed to delete variant", err)
+		return
+	}
+
+	response.SendResponse(w, http.StatusOK, "Variant deleted successfully", "", nil, false)
+}
+
+// SetActiveVariantHandler selects the variant a project serves when the request doesn't pick one
+func SetActiveVariantHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, ownerID, ok := requireProjectOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var req ActiveVariantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
+		return
+	}
+
+	if req.VariantID != nil {
+		if _, err := findProjectVariant(r.Context(), projectID, *req.VariantID); err != nil {
+			sendLookupError(w, "Variant not found", err)
+			return
+		}
+	}
+
+	updatedProject, err := crud.UpdateAudited(r.Context(), ownerID, "project", projectID, map[string]interface{}{"active_variant_id": req.VariantID})
+	if err != nil {
+		sendServerError(w, "Failed to set active variant", err)
+		return
+	}
+
+	response.SendResponse(w, http.StatusOK, "Active variant updated successfully", "", updatedProject, false)
+}
@@ -0,0 +1,6 @@
+//go:build race
+
+package handler_test
+
+// raceEnabled is set when the tests run with -race, whose instrumentation allocates
+const raceEnabled = true
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/adolfooes/api_faker/internal/db"
+	"github.com/adolfooes/api_faker/internal/repository"
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/adolfooes/api_faker/pkg/utils/response"
+	"github.com/gorilla/mux"
+)
+
+// getIDFromVars extracts a numeric ID from the URL path variables
+func getIDFromVars(r *http.Request, name string) (int64, error) {
+	idStr, ok := mux.Vars(r)[name]
+	if !ok || idStr == "" {
+		return 0, fmt.Errorf("%s is missing in the request", name)
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+
+	return id, nil
+}
+
+// validationError marks an error found by a validation that runs inside a transaction,
+// so it can be told apart from database errors and reported as a client error
+type validationError struct {
+	error
+}
+
+// isValidationError reports whether err was returned by a validation inside a transaction
+func isValidationError(err error) bool {
+	var vErr validationError
+	return errors.As(err, &vErr)
+}
+
+// databaseErrorStatus returns the status of a response to a failed database operation: 504 when the operation
+// timed out, 503 when the database is unavailable, and status for any other error
+func databaseErrorStatus(err error, status int) int {
+	switch {
+	case db.IsTimeout(err):
+		return http.StatusGatewayTimeout
+	case db.IsUnavailable(err):
+		return http.StatusServiceUnavailable
+	}
+	return status
+}
+
+// sendServerError responds to an operation that failed on the server, with 500 unless the database
+// timed out or is unavailable. Nothing is sent when the client already cancelled the request.
+func sendServerError(w http.ResponseWriter, message string, err error) {
+	if db.IsCanceled(err) {
+		return
+	}
+	response.SendResponse(w, databaseErrorStatus(err, http.StatusInternalServerError), message, err.Error(), nil, false)
+}
+
+// sendLookupError responds to a record that couldn't be read, with 404 unless the database timed out
+// or is unavailable, so a slow database isn't reported as a missing record
+func sendLookupError(w http.ResponseWriter, message string, err error) {
+	if db.IsCanceled(err) {
+		return
+	}
+	response.SendResponse(w, databaseErrorStatus(err, http.StatusNotFound), message, err.Error(), nil, false)
+}
+
+// sendAuthorizationError responds to a failed ownership check: 401 when the caller doesn't own the record or
+// it doesn't exist (repository.ErrNotFound), and a server error when the check itself failed, e.g. on a database timeout.
+// The message is fixed, the error is only sent as the stack, which production responses leave out.
+func sendAuthorizationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: you are not authorized to perform this operation", err.Error(), nil, false)
+		return
+	}
+	sendServerError(w, "Failed to check authorization", err)
+}
+
+// lockRecords locks the records of a table in ascending id order, so concurrent transactions
+// locking the same records can't deadlock
+func lockRecords(tx *crud.Tx, table string, ids ...int64) error {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i, id := range ids {
+		if i > 0 && ids[i-1] == id {
+			continue
+		}
+		if err := tx.Lock(table, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/api/authz"
+	"github.com/adolfooes/api_faker/internal/repository"
 	"github.com/adolfooes/api_faker/pkg/utils/crud"
 	"github.com/adolfooes/api_faker/pkg/utils/response"
 	"github.com/gorilla/mux"
@@ -30,38 +34,39 @@ func validateRequiredResponseModelFields(model ResponseModel) error {
 	return nil
 }
 
-func validateURLHTTPStatusExists(urlHTTPStatusID int) error {
+func validateURLHTTPStatusExists(ctx context.Context, urlHTTPStatusID int) error {
 	filters := map[string]interface{}{"id": urlHTTPStatusID}
-	statuses, err := crud.List("url_http_status", filters)
+	statuses, err := crud.List(ctx, "url_http_status", filters)
 	if err != nil || len(statuses) == 0 {
 		return fmt.Errorf("url_http_status_id does not exist")
 	}
 	return nil
 }
 
-func authorizeOwnershipByURLHTTPStatusID(urlHTTPStatusID int, ownerID int64) error {
-	// First, fetch the url_id associated with the provided url_http_status_id
-	filters := map[string]interface{}{"id": urlHTTPStatusID}
-	urlHTTPStatuses, err := crud.List("url_http_status", filters)
-	if err != nil || len(urlHTTPStatuses) == 0 {
-		return fmt.Errorf("url_http_status_id not found")
+func authorizeOwnershipByURLHTTPStatusID(ctx context.Context, urlHTTPStatusID int, ownerID int64) error {
+	// Ownership is checked through the url_config (and its project) of the HTTP status
+	err := authorizeURLHTTPStatusOwnership(ctx, int64(urlHTTPStatusID), ownerID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("you are not authorized to modify this response model: %w", repository.ErrNotFound)
 	}
-	urlHTTPStatus := urlHTTPStatuses[0]
-
-	// Now, fetch the corresponding url_config using the url_id to check ownership
-	urlID := urlHTTPStatus["url_id"].(int)
-	filters = map[string]interface{}{"id": urlID}
-	urlConfigs, err := crud.List("url_config", filters)
-	if err != nil || len(urlConfigs) == 0 {
-		return fmt.Errorf("url_config not found for the provided url_http_status_id")
+	if err != nil {
+		return err
 	}
 
-	// Check ownership of the url_config
-	if urlConfigs[0]["owner_id"].(int64) != ownerID {
-		return fmt.Errorf("you are not authorized to modify this response model")
+	return nil
+}
+
+// authorizeResponseModelOwnership validates if the current user owns the response model
+func authorizeResponseModelOwnership(ctx context.Context, modelID int64, ownerID int64) error {
+	model, err := repository.Default().GetResponseModel(ctx, modelID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("response model not found: %w", err)
+	}
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return authorizeOwnershipByURLHTTPStatusID(ctx, int(model.URLHTTPStatusID), ownerID)
 }
 
 func CreateResponseModelHandler(w http.ResponseWriter, r *http.Request) {
@@ -81,7 +86,7 @@ func CreateResponseModelHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate the existence of url_http_status_id
-	if err := validateURLHTTPStatusExists(model.URLHTTPStatusID); err != nil {
+	if err := validateURLHTTPStatusExists(r.Context(), model.URLHTTPStatusID); err != nil {
 		response.SendResponse(w, http.StatusBadRequest, "Invalid url_http_status_id", err.Error(), nil, false)
 		return
 	}
@@ -99,33 +104,42 @@ func CreateResponseModelHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authorize ownership by checking the owner of the url_http_status_id
-	if err := authorizeOwnershipByURLHTTPStatusID(model.URLHTTPStatusID, ownerID); err != nil {
-		response.SendResponse(w, http.StatusUnauthorized, err.Error(), "", nil, false)
+	if err := authorizeOwnershipByURLHTTPStatusID(r.Context(), model.URLHTTPStatusID, ownerID); err != nil {
+		sendAuthorizationError(w, err)
+		return
+	}
+
+	// The model is stored as JSONB, so it is sent to the database encoded
+	modelJSON, err := json.Marshal(model.Model)
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid model", err.Error(), nil, false)
 		return
 	}
 
 	// Insert the new response model into the database
 	columns := []string{"url_http_status_id", "model", "description"}
-	values := []interface{}{model.URLHTTPStatusID, model.Model, model.Description}
-	createdModel, err := crud.Create("response_model", columns, values) // Fetch the created response model object
+	values := []interface{}{model.URLHTTPStatusID, string(modelJSON), model.Description}
+	createdModel, err := crud.CreateAudited(r.Context(), ownerID, "response_model", columns, values) // Fetch the created response model object
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to create response model", err.Error(), nil, false)
+		sendServerError(w, "Failed to create response model", err)
 		return
 	}
 
 	response.SendResponse(w, http.StatusCreated, "Response model created successfully", "", createdModel, false)
 }
 
+var responseModelListSpec = listSpec{
+	table:       "response_model",
+	name:        "response models",
+	filterable:  []string{"url_http_status_id"},
+	sortable:    []string{"id", "created_at", "updated_at"},
+	defaultSort: []crud.SortField{{Column: "id"}},
+	scoped:      true,
+}
+
 // GetAllResponseModelsHandler retrieves all response models from the database
 func GetAllResponseModelsHandler(w http.ResponseWriter, r *http.Request) {
-	filters := map[string]interface{}{} // No filters, get all response models
-	results, err := crud.List("response_model", filters)
-	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to retrieve response models", err.Error(), nil, false)
-		return
-	}
-
-	response.SendResponse(w, http.StatusOK, "Response models retrieved successfully", "", results, false)
+	sendList(w, r, responseModelListSpec, nil, "Response models retrieved successfully")
 }
 
 // GetResponseModelHandler retrieves a single response model by ID from the database
@@ -145,10 +159,16 @@ func GetResponseModelHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Query the database for the response model by ID
-	result, err := crud.Read("response_model", id)
+	accountID, err := authz.AccountID(r)
+	if err != nil {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Account ID not found", err.Error(), nil, false)
+		return
+	}
+
+	// Query the database for the response model by ID, if it belongs to a project the caller can see
+	result, err := authz.ReadScoped(r.Context(), accountID, "response_model", id)
 	if err != nil {
-		response.SendResponse(w, http.StatusNotFound, "Failed to retrieve response model", err.Error(), nil, false)
+		sendLookupError(w, "Failed to retrieve response model", err)
 		return
 	}
 
@@ -157,8 +177,14 @@ func GetResponseModelHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func UpdateResponseModelHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromVars(r, "id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
+		return
+	}
+
 	var model ResponseModel
-	err := json.NewDecoder(r.Body).Decode(&model)
+	err = json.NewDecoder(r.Body).Decode(&model)
 	if err != nil {
 		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
 		return
@@ -171,7 +197,7 @@ func UpdateResponseModelHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate the existence of url_http_status_id
-	if err := validateURLHTTPStatusExists(model.URLHTTPStatusID); err != nil {
+	if err := validateURLHTTPStatusExists(r.Context(), model.URLHTTPStatusID); err != nil {
 		response.SendResponse(w, http.StatusBadRequest, "Invalid url_http_status_id", err.Error(), nil, false)
 		return
 	}
@@ -188,21 +214,32 @@ func UpdateResponseModelHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Authorize ownership by checking the owner of the url_http_status_id
-	if err := authorizeOwnershipByURLHTTPStatusID(model.URLHTTPStatusID, ownerID); err != nil {
-		response.SendResponse(w, http.StatusUnauthorized, err.Error(), "", nil, false)
+	// Authorize ownership of the response model being updated and of its new url_http_status_id
+	if err := authorizeResponseModelOwnership(r.Context(), id, ownerID); err != nil {
+		sendAuthorizationError(w, err)
+		return
+	}
+	if err := authorizeOwnershipByURLHTTPStatusID(r.Context(), model.URLHTTPStatusID, ownerID); err != nil {
+		sendAuthorizationError(w, err)
 		return
 	}
 
-	// Update the response model in the database
+	// The model is stored as JSONB, so it is sent to the database encoded
+	modelJSON, err := json.Marshal(model.Model)
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid model", err.Error(), nil, false)
+		return
+	}
+
+	// Update the response model in the database, which also saves a new revision
 	updates := map[string]interface{}{
 		"url_http_status_id": model.URLHTTPStatusID,
-		"model":              model.Model,
+		"model":              string(modelJSON),
 		"description":        model.Description,
 	}
-	updatedModel, err := crud.Update("response_model", model.ID, updates) // Fetch the updated response model object
+	updatedModel, err := crud.UpdateAudited(r.Context(), ownerID, "response_model", id, updates) // Fetch the updated response model object
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to update response model", err.Error(), nil, false)
+		sendServerError(w, "Failed to update response model", err)
 		return
 	}
 
@@ -211,16 +248,28 @@ func UpdateResponseModelHandler(w http.ResponseWriter, r *http.Request) {
 
 // DeleteResponseModelHandler handles deleting a response model
 func DeleteResponseModelHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := getIDFromVars(r, "id")
 	if err != nil {
 		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
 		return
 	}
 
-	err = crud.Delete("response_model", id)
+	// Extract the owner ID from the context (injected by the JWT middleware)
+	ownerID, err := authz.AccountID(r)
+	if err != nil {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Owner ID not found", "", nil, false)
+		return
+	}
+
+	// Authorize ownership of the response model
+	if err := authorizeResponseModelOwnership(r.Context(), id, ownerID); err != nil {
+		sendAuthorizationError(w, err)
+		return
+	}
+
+	err = crud.DeleteAudited(r.Context(), ownerID, "response_model", id)
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to delete response model", err.Error(), nil, false)
+		sendServerError(w, "Failed to delete response model", err)
 		return
 	}
 
@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/adolfooes/api_faker/internal/api/authz"
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/adolfooes/api_faker/pkg/utils/jsondiff"
+	"github.com/adolfooes/api_faker/pkg/utils/response"
+)
+
+// versionedResource describes how the revisions of a versioned table are authorized and rolled back
+type versionedResource struct {
+	table string
+	// authorize checks that the account owns the record
+	authorize func(ctx context.Context, recordID int64, ownerID int64) error
+	// validateRollback checks, inside the rollback transaction, that restoring the values keeps the configuration consistent
+	validateRollback func(tx *crud.Tx, recordID int64, values crud.Row) error
+}
+
+var versionedResources = map[string]versionedResource{
+	"response_model": {
+		table:            "response_model",
+		authorize:        authorizeResponseModelOwnership,
+		validateRollback: func(*crud.Tx, int64, crud.Row) error { return nil },
+	},
+	"url_config": {
+		table:            "url_config",
+		authorize:        authorizeURLOwnership,
+		validateRollback: validateURLConfigRollback,
+	},
+	"url_http_status": {
+		table:            "url_http_status",
+		authorize:        authorizeURLHTTPStatusOwnership,
+		validateRollback: validateURLHTTPStatusRollback,
+	},
+}
+
+// validateURLConfigRollback rejects a rollback that would duplicate the path and method of another URL config
+func validateURLConfigRollback(tx *crud.Tx, recordID int64, values crud.Row) error {
+	current, err := tx.Read("url_config", recordID)
+	if err != nil {
+		return err
+	}
+
+	projectID := current.Int64("project_id")
+	if err := tx.Lock("project", projectID); err != nil {
+		return err
+	}
+
+	exists, err := checkDuplicateURLConfig(tx, projectID, values.String("path"), values.String("method"), recordID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return validationError{fmt.Errorf("URL config with the same path and method already exists")}
+	}
+	return nil
+}
+
+// validateURLHTTPStatusRollback rejects a rollback that would push the URL's percentages over 100%
+func validateURLHTTPStatusRollback(tx *crud.Tx, recordID int64, values crud.Row) error {
+	current, err := tx.Read("url_http_status", recordID)
+	if err != nil {
+		return err
+	}
+
+	httpStatus := values.Int64("http_status")
+	if err := validateHTTPStatusCode(int(httpStatus)); err != nil {
+		return validationError{err}
+	}
+
+	urlID := current.Int64("url_id")
+	if err := tx.Lock("url_config", urlID); err != nil {
+		return err
+	}
+
+	percentage := values.Int64("percentage")
+	return validatePercentageDistribution(tx, urlID, current["variant_id"], int(percentage), recordID)
+}
+
+// requireRevisionAccess reads the record id from the path and checks that the caller owns the record.
+// It sends the error response itself and returns false when the request must stop.
+func requireRevisionAccess(w http.ResponseWriter, r *http.Request, resource versionedResource) (int64, int64, bool) {
+	recordID, err := getIDFromVars(r, "id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
+		return 0, 0, false
+	}
+
+	ownerID, err := authz.AccountID(r)
+	if err != nil {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Owner ID not found", err.Error(), nil, false)
+		return 0, 0, false
+	}
+
+	if err := resource.authorize(r.Context(), recordID, ownerID); err != nil {
+		sendAuthorizationError(w, err)
+		return 0, 0, false
+	}
+
+	return recordID, ownerID, true
+}
+
+// formatRevision decodes the JSONB snapshot of a revision so it is returned as JSON
+func formatRevision(revision crud.Row) crud.Row {
+	revision["data"] = revision.JSON("data")
+	return revision
+}
+
+// decodeRevisionData returns the snapshot stored in a revision
+func decodeRevisionData(revision crud.Row) (map[string]interface{}, error) {
+	raw := revision.JSON("data")
+	if raw == nil {
+		return nil, fmt.Errorf("revision has no data")
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("error decoding revision data: %w", err)
+	}
+	return data, nil
+}
+
+// rollbackValues picks the versioned columns of a snapshot, encoded the way the database expects them
+// according to the column types of the schema registry
+func rollbackValues(table string, data map[string]interface{}) (crud.Row, error) {
+	values := crud.Row{}
+	for _, column := range crud.VersionedColumns(table) {
+		value := data[column]
+		columnType, _ := crud.ColumnTypeOf(table, column)
+
+		switch {
+		case columnType == crud.ColumnJSON:
+			// Any JSON value is a valid document, scalars included, so each is encoded as is
+			if value == nil {
+				values[column] = nil
+				continue
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("error encoding %s: %w", column, err)
+			}
+			values[column] = string(encoded)
+		case columnType == crud.ColumnInt && value != nil:
+			// JSON numbers decode as float64
+			number, ok := value.(float64)
+			if !ok || number != math.Trunc(number) {
+				return nil, fmt.Errorf("%s must be an integer", column)
+			}
+			values[column] = int64(number)
+		default:
+			values[column] = value
+		}
+	}
+	return values, nil
+}
+
+// getVersionParam parses a revision version from a query parameter
+func getVersionParam(value string, name string) (int, error) {
+	version, err := strconv.Atoi(value)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("%s must be a positive revision version", name)
+	}
+	return version, nil
+}
+
+// ListRevisionsHandler returns a handler listing the revisions of a record, newest first
+func ListRevisionsHandler(table string) http.HandlerFunc {
+	resource := versionedResources[table]
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		recordID, _, ok := requireRevisionAccess(w, r, resource)
+		if !ok {
+			return
+		}
+
+		revisions, err := crud.ListRevisions(r.Context(), resource.table, recordID)
+		if err != nil {
+			sendServerError(w, "Failed to retrieve revisions", err)
+			return
+		}
+
+		for _, revision := range revisions {
+			formatRevision(revision)
+		}
+
+		response.SendResponse(w, http.StatusOK, "Revisions retrieved successfully", "", revisions, false)
+	}
+}
+
+// GetRevisionHandler returns a handler retrieving one revision of a record
+func GetRevisionHandler(table string) http.HandlerFunc {
+	resource := versionedResources[table]
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		recordID, _, ok := requireRevisionAccess(w, r, resource)
+		if !ok {
+			return
+		}
+
+		versionID, err := getIDFromVars(r, "version")
+		if err != nil {
+			response.SendResponse(w, http.StatusBadRequest, "Invalid version parameter", err.Error(), nil, false)
+			return
+		}
+		version := int(versionID)
+
+		revision, err := crud.ReadRevision(r.Context(), resource.table, recordID, version)
+		if err != nil {
+			sendLookupError(w, "Revision not found", err)
+			return
+		}
+
+		response.SendResponse(w, http.StatusOK, "Revision retrieved successfully", "", formatRevision(revision), false)
+	}
+}
+
+// DiffRevisionsHandler returns a handler comparing two revisions of a record.
+// The versions come from the from and to query parameters, to defaults to the latest revision.
+func DiffRevisionsHandler(table string) http.HandlerFunc {
+	resource := versionedResources[table]
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		recordID, _, ok := requireRevisionAccess(w, r, resource)
+		if !ok {
+			return
+		}
+
+		params := r.URL.Query()
+		fromVersion, err := getVersionParam(params.Get("from"), "from")
+		if err != nil {
+			response.SendResponse(w, http.StatusBadRequest, "Invalid from parameter", err.Error(), nil, false)
+			return
+		}
+
+		var toRevision crud.Row
+		if toStr := params.Get("to"); toStr != "" {
+			toVersion, err := getVersionParam(toStr, "to")
+			if err != nil {
+				response.SendResponse(w, http.StatusBadRequest, "Invalid to parameter", err.Error(), nil, false)
+				return
+			}
+			toRevision, err = crud.ReadRevision(r.Context(), resource.table, recordID, toVersion)
+			if err != nil {
+				sendLookupError(w, "Revision not found", err)
+				return
+			}
+		} else {
+			revisions, err := crud.ListRevisions(r.Context(), resource.table, recordID)
+			if err != nil || len(revisions) == 0 {
+				response.SendResponse(w, http.StatusNotFound, "Revision not found", "the record has no revisions", nil, false)
+				return
+			}
+			toRevision = revisions[0]
+		}
+
+		fromRevision, err := crud.ReadRevision(r.Context(), resource.table, recordID, fromVersion)
+		if err != nil {
+			sendLookupError(w, "Revision not found", err)
+			return
+		}
+
+		fromData, err := decodeRevisionData(fromRevision)
+		if err != nil {
+			sendServerError(w, "Failed to read revision", err)
+			return
+		}
+		toData, err := decodeRevisionData(toRevision)
+		if err != nil {
+			sendServerError(w, "Failed to read revision", err)
+			return
+		}
+
+		// Bookkeeping columns change on every revision and would only add noise
+		for _, column := range []string{"created_at", "updated_at"} {
+			delete(fromData, column)
+			delete(toData, column)
+		}
+
+		response.SendResponse(w, http.StatusOK, "Revisions compared successfully", "", map[string]interface{}{
+			"from":    fromRevision["version"],
+			"to":      toRevision["version"],
+			"changes": jsondiff.Diff(fromData, toData),
+		}, false)
+	}
+}
+
+// RollbackRevisionHandler returns a handler restoring a record to one of its revisions.
+// The rollback is an update itself, so it is audited and saved as a new revision.
+func RollbackRevisionHandler(table string) http.HandlerFunc {
+	resource := versionedResources[table]
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		recordID, ownerID, ok := requireRevisionAccess(w, r, resource)
+		if !ok {
+			return
+		}
+
+		versionID, err := getIDFromVars(r, "version")
+		if err != nil {
+			response.SendResponse(w, http.StatusBadRequest, "Invalid version parameter", err.Error(), nil, false)
+			return
+		}
+		version := int(versionID)
+
+		revision, err := crud.ReadRevision(r.Context(), resource.table, recordID, version)
+		if err != nil {
+			sendLookupError(w, "Revision not found", err)
+			return
+		}
+
+		data, err := decodeRevisionData(revision)
+		if err != nil {
+			sendServerError(w, "Failed to read revision", err)
+			return
+		}
+
+		values, err := rollbackValues(resource.table, data)
+		if err != nil {
+			sendServerError(w, "Failed to read revision", err)
+			return
+		}
+
+		var restored crud.Row
+		err = crud.WithTx(r.Context(), func(tx *crud.Tx) error {
+			if err := resource.validateRollback(tx, recordID, values); err != nil {
+				return err
+			}
+
+			var err error
+			restored, err = tx.UpdateAudited(ownerID, resource.table, recordID, values)
+			return err
+		})
+		if isValidationError(err) {
+			response.SendResponse(w, http.StatusConflict, "Rollback validation failed", err.Error(), nil, false)
+			return
+		}
+		if err != nil {
+			sendServerError(w, "Failed to roll back", err)
+			return
+		}
+
+		response.SendResponse(w, http.StatusOK, fmt.Sprintf("Rolled back to revision %d successfully", version), "", restored, false)
+	}
+}
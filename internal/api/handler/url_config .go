@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/api/authz"
 	"github.com/adolfooes/api_faker/pkg/utils/crud"
 	"github.com/adolfooes/api_faker/pkg/utils/response"
 	"github.com/gorilla/mux"
@@ -53,18 +54,22 @@ func validateHTTPMethod(method string) error {
 	return fmt.Errorf("invalid HTTP method: %s", method)
 }
 
-func checkDuplicateURLConfig(projectID int64, path string, method string) (bool, error) {
+// checkDuplicateURLConfig reports whether another URL config of the project (than excludeID) has the path and method.
+// It runs in the transaction that writes the URL config, after the project was locked.
+func checkDuplicateURLConfig(tx *crud.Tx, projectID int64, path string, method string, excludeID int64) (bool, error) {
 	filters := map[string]interface{}{
 		"project_id": projectID,
 		"path":       path,
 		"method":     method,
 	}
-	urlConfigs, err := crud.List("url_config", filters)
+	urlConfigs, err := tx.List("url_config", filters)
 	if err != nil {
 		return false, err
 	}
-	if len(urlConfigs) > 0 {
-		return true, nil
+	for _, urlConfig := range urlConfigs {
+		if urlConfig.Int64("id") != excludeID {
+			return true, nil
+		}
 	}
 	return false, nil
 }
@@ -113,44 +118,57 @@ func CreateURLConfigHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authorize the project ownership
-	if err := authorizeProjectOwnership(urlConfig.ProjectID, ownerID); err != nil {
-		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: "+err.Error(), "", nil, false)
+	if err := authorizeProjectOwnership(r.Context(), urlConfig.ProjectID, ownerID); err != nil {
+		sendAuthorizationError(w, err)
 		return
 	}
 
-	// Check for duplicate URL config (same path and method within the same project)
-	exists, err := checkDuplicateURLConfig(urlConfig.ProjectID, urlConfig.Path, urlConfig.Method)
-	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Error checking duplicate URL config", err.Error(), nil, false)
-		return
-	}
-	if exists {
-		response.SendResponse(w, http.StatusConflict, "URL config with the same path and method already exists", "", nil, false)
+	// The project is locked while duplicates are checked and the URL config is inserted
+	var createdConfig crud.Row
+	err = crud.WithTx(r.Context(), func(tx *crud.Tx) error {
+		if err := tx.Lock("project", urlConfig.ProjectID); err != nil {
+			return err
+		}
+
+		// Check for duplicate URL config (same path and method within the same project)
+		exists, err := checkDuplicateURLConfig(tx, urlConfig.ProjectID, urlConfig.Path, urlConfig.Method, 0)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return validationError{fmt.Errorf("URL config with the same path and method already exists")}
+		}
+
+		// Insert the new URL config into the database
+		columns := []string{"path", "method", "description", "project_id"}
+		values := []interface{}{urlConfig.Path, urlConfig.Method, urlConfig.Description, urlConfig.ProjectID}
+		createdConfig, err = tx.CreateAudited(ownerID, "url_config", columns, values) // Fetch the created object
+		return err
+	})
+	if isValidationError(err) {
+		response.SendResponse(w, http.StatusConflict, err.Error(), "", nil, false)
 		return
 	}
-
-	// Insert the new URL config into the database
-	columns := []string{"path", "method", "description", "project_id"}
-	values := []interface{}{urlConfig.Path, urlConfig.Method, urlConfig.Description, urlConfig.ProjectID}
-	createdConfig, err := crud.Create("url_config", columns, values) // Fetch the created object
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to create URL config", err.Error(), nil, false)
+		sendServerError(w, "Failed to create URL config", err)
 		return
 	}
 
 	response.SendResponse(w, http.StatusCreated, "URL config created successfully", "", createdConfig, false)
 }
 
+var urlConfigListSpec = listSpec{
+	table:       "url_config",
+	name:        "URL configs",
+	filterable:  []string{"project_id", "path", "method"},
+	sortable:    []string{"id", "path", "method", "created_at", "updated_at"},
+	defaultSort: []crud.SortField{{Column: "id"}},
+	scoped:      true,
+}
+
 // GetAllURLConfigsHandler retrieves all URL configs from the database
 func GetAllURLConfigsHandler(w http.ResponseWriter, r *http.Request) {
-	filters := map[string]interface{}{} // No filters, get all URL configs
-	results, err := crud.List("url_config", filters)
-	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to retrieve URL configs", err.Error(), nil, false)
-		return
-	}
-
-	response.SendResponse(w, http.StatusOK, "URL configs retrieved successfully", "", results, false)
+	sendList(w, r, urlConfigListSpec, nil, "URL configs retrieved successfully")
 }
 
 // GetURLConfigHandler retrieves a single URL config by ID from the database
@@ -170,10 +188,16 @@ func GetURLConfigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Read the URL config from the database
-	result, err := crud.Read("url_config", id)
+	accountID, err := authz.AccountID(r)
+	if err != nil {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Account ID not found", err.Error(), nil, false)
+		return
+	}
+
+	// Read the URL config, if it belongs to a project the caller can see
+	result, err := authz.ReadScoped(r.Context(), accountID, "url_config", id)
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to retrieve URL config", err.Error(), nil, false)
+		sendLookupError(w, "Failed to retrieve URL config", err)
 		return
 	}
 
@@ -182,8 +206,14 @@ func GetURLConfigHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func UpdateURLConfigHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromVars(r, "id")
+	if err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
+		return
+	}
+
 	var urlConfig URLConfig
-	err := json.NewDecoder(r.Body).Decode(&urlConfig)
+	err = json.NewDecoder(r.Body).Decode(&urlConfig)
 	if err != nil {
 		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
 		return
@@ -221,22 +251,51 @@ func UpdateURLConfigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Authorize the project ownership
-	if err := authorizeProjectOwnership(urlConfig.ProjectID, ownerID); err != nil {
-		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: "+err.Error(), "", nil, false)
+	// Authorize the ownership of the URL config and of the project it is moved to
+	if err := authorizeURLOwnership(r.Context(), id, ownerID); err != nil {
+		sendAuthorizationError(w, err)
 		return
 	}
+	if err := authorizeProjectOwnership(r.Context(), urlConfig.ProjectID, ownerID); err != nil {
+		sendAuthorizationError(w, err)
+		return
+	}
+
+	// The project is locked while duplicates are checked and the URL config is updated
+	var updatedConfig crud.Row
+	err = crud.WithTx(r.Context(), func(tx *crud.Tx) error {
+		current, err := tx.Read("url_config", id)
+		if err != nil {
+			return err
+		}
+		if err := lockRecords(tx, "project", current.Int64("project_id"), urlConfig.ProjectID); err != nil {
+			return err
+		}
+
+		exists, err := checkDuplicateURLConfig(tx, urlConfig.ProjectID, urlConfig.Path, urlConfig.Method, id)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return validationError{fmt.Errorf("URL config with the same path and method already exists")}
+		}
 
-	// Update the URL config in the database
-	updates := map[string]interface{}{
-		"path":        urlConfig.Path,
-		"method":      urlConfig.Method,
-		"description": urlConfig.Description,
-		"project_id":  urlConfig.ProjectID,
+		// Update the URL config in the database
+		updates := map[string]interface{}{
+			"path":        urlConfig.Path,
+			"method":      urlConfig.Method,
+			"description": urlConfig.Description,
+			"project_id":  urlConfig.ProjectID,
+		}
+		updatedConfig, err = tx.UpdateAudited(ownerID, "url_config", id, updates) // Fetch the updated object
+		return err
+	})
+	if isValidationError(err) {
+		response.SendResponse(w, http.StatusConflict, err.Error(), "", nil, false)
+		return
 	}
-	updatedConfig, err := crud.Update("url_config", urlConfig.ID, updates) // Fetch the updated object
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to update URL config", err.Error(), nil, false)
+		sendServerError(w, "Failed to update URL config", err)
 		return
 	}
 
@@ -245,16 +304,28 @@ func UpdateURLConfigHandler(w http.ResponseWriter, r *http.Request) {
 
 // DeleteURLConfigHandler handles deleting a URL config
 func DeleteURLConfigHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := getIDFromVars(r, "id")
 	if err != nil {
 		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
 		return
 	}
 
-	err = crud.Delete("url_config", id)
+	// Extract the owner ID from the context (JWT middleware)
+	ownerID, err := authz.AccountID(r)
+	if err != nil {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Owner ID not found", "", nil, false)
+		return
+	}
+
+	// Authorize the ownership of the URL config
+	if err := authorizeURLOwnership(r.Context(), id, ownerID); err != nil {
+		sendAuthorizationError(w, err)
+		return
+	}
+
+	err = crud.DeleteAudited(r.Context(), ownerID, "url_config", id)
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to delete URL config", err.Error(), nil, false)
+		sendServerError(w, "Failed to delete URL config", err)
 		return
 	}
 
@@ -1,22 +1,29 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/api/authz"
+	"github.com/adolfooes/api_faker/internal/repository"
 	"github.com/adolfooes/api_faker/pkg/utils/crud"
 	"github.com/adolfooes/api_faker/pkg/utils/response"
 )
 
 // URLHTTPStatus represents a structure for an HTTP status associated with a URL
 type URLHTTPStatus struct {
-	ID         int64 `json:"id"`
-	URLID      int64 `json:"url_id"`
-	HTTPStatus int   `json:"http_status"`
-	Percentage int   `json:"percentage"`
+	ID         int64             `json:"id"`
+	URLID      int64             `json:"url_id"`
+	HTTPStatus int               `json:"http_status"`
+	Percentage int               `json:"percentage"`
+	VariantID  *int64            `json:"variant_id"`  // Empty for the project's default responses
+	Trailers   map[string]string `json:"trailers"`    // Sent after the body, by name
+	EarlyHints []string          `json:"early_hints"` // Link header values sent in a 103 Early Hints response first
 }
 
 func validateRequiredURLHTTPStatusFields(status URLHTTPStatus) error {
@@ -29,7 +36,10 @@ func validateRequiredURLHTTPStatusFields(status URLHTTPStatus) error {
 	if status.Percentage < 0 || status.Percentage > 100 {
 		return fmt.Errorf("percentage must be between 0 and 100")
 	}
-	return nil
+	if err := validateTrailers(status.Trailers); err != nil {
+		return err
+	}
+	return validateEarlyHints(status.EarlyHints)
 }
 
 func validateHTTPStatusCode(httpStatus int) error {
@@ -39,56 +49,92 @@ func validateHTTPStatusCode(httpStatus int) error {
 	return nil
 }
 
-func validatePercentageDistribution(urlID int64, newPercentage int) error {
-	filters := map[string]interface{}{
-		"url_id": urlID,
-	}
-	urlHTTPStatuses, err := crud.List("url_http_status", filters)
+// validatePercentageDistribution checks that the statuses of a URL in a variant don't add up to more than 100%.
+// The default responses (nil variant) are a distribution of their own. The status identified by
+// excludeID (the one being updated, if any) is left out of the total. It runs in the transaction
+// that writes the status, after the URL was locked, so concurrent writes can't both pass the check.
+func validatePercentageDistribution(tx *crud.Tx, urlID int64, variantID interface{}, newPercentage int, excludeID int64) error {
+	urlHTTPStatuses, _, err := tx.Raw(
+		"SELECT id, percentage FROM url_http_status WHERE url_id = $1 AND variant_id IS NOT DISTINCT FROM $2",
+		urlID, variantID,
+	)
 	if err != nil {
-		return fmt.Errorf("error fetching existing HTTP statuses for URL: %v", err)
+		return fmt.Errorf("error fetching existing HTTP statuses for URL: %w", err)
 	}
 
 	totalPercentage := 0
 	for _, status := range urlHTTPStatuses {
-		totalPercentage += int(status["percentage"].(int64))
+		if status.Int64("id") == excludeID {
+			continue
+		}
+		totalPercentage += status.Int("percentage")
 	}
 
 	if totalPercentage+newPercentage > 100 {
-		return fmt.Errorf("total percentage exceeds 100%%")
+		return validationError{fmt.Errorf("total percentage exceeds 100%%")}
 	}
 
 	return nil
 }
 
-func authorizeURLOwnership(urlID int64, ownerID int64) error {
-	// Step 1: Read the URL config to get the project_id from url_config
-	urlConfig, err := crud.Read("url_config", urlID)
-	if err != nil {
-		return fmt.Errorf("URL not found")
+// validateStatusVariant checks that the variant of a status belongs to the project of its URL
+func validateStatusVariant(ctx context.Context, urlID int64, variantID *int64) error {
+	if variantID == nil {
+		return nil
 	}
 
-	projectID, ok := urlConfig["project_id"].(int64)
-	if !ok {
-		return fmt.Errorf("project_id not found in URL config")
+	results, _, err := crud.Raw(ctx,
+		"SELECT v.id FROM project_variant v JOIN url_config uc ON uc.project_id = v.project_id WHERE uc.id = $1 AND v.id = $2",
+		urlID, *variantID,
+	)
+	if err != nil {
+		return fmt.Errorf("error fetching variant: %w", err)
 	}
+	if len(results) == 0 {
+		return fmt.Errorf("variant %d does not belong to the project of the URL", *variantID)
+	}
+
+	return nil
+}
 
-	project, err := crud.Read("project", projectID)
+func authorizeURLOwnership(ctx context.Context, urlID int64, ownerID int64) error {
+	// Step 1: Read the URL config to get the project it belongs to
+	urlConfig, err := repository.Default().GetURLConfig(ctx, urlID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("URL not found: %w", err)
+	}
 	if err != nil {
-		return fmt.Errorf("Project not found")
+		return err
 	}
 
-	projectOwnerID, ok := project["owner_id"].(int64)
-	if !ok {
-		return fmt.Errorf("owner_id not found in project")
+	project, err := repository.Default().GetProject(ctx, urlConfig.ProjectID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("project not found: %w", err)
+	}
+	if err != nil {
+		return err
 	}
 
-	if projectOwnerID != ownerID {
-		return fmt.Errorf("you are not authorized to modify this URL")
+	if project.OwnerID != ownerID {
+		return fmt.Errorf("you are not authorized to modify this URL: %w", repository.ErrNotFound)
 	}
 
 	return nil
 }
 
+// authorizeURLHTTPStatusOwnership validates if the current user owns the URL the HTTP status belongs to
+func authorizeURLHTTPStatusOwnership(ctx context.Context, statusID int64, ownerID int64) error {
+	status, err := repository.Default().GetURLHTTPStatus(ctx, statusID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("HTTP status not found: %w", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return authorizeURLOwnership(ctx, status.URLID, ownerID)
+}
+
 func CreateURLHTTPStatusHandler(w http.ResponseWriter, r *http.Request) {
 	var status URLHTTPStatus
 
@@ -123,42 +169,68 @@ func CreateURLHTTPStatusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := authorizeURLOwnership(status.URLID, ownerID); err != nil {
-		response.SendResponse(w, http.StatusUnauthorized, err.Error(), "", nil, false)
+	if err := authorizeURLOwnership(r.Context(), status.URLID, ownerID); err != nil {
+		sendAuthorizationError(w, err)
 		return
 	}
 
-	if err := validatePercentageDistribution(status.URLID, status.Percentage); err != nil {
-		response.SendResponse(w, http.StatusBadRequest, "Percentage validation failed", err.Error(), nil, false)
+	if err := validateStatusVariant(r.Context(), status.URLID, status.VariantID); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid variant_id", err.Error(), nil, false)
 		return
 	}
 
-	columns := []string{"url_id", "http_status", "percentage"}
-	values := []interface{}{status.URLID, status.HTTPStatus, status.Percentage}
-	createdStatus, err := crud.Create("url_http_status", columns, values) // Fetch the created object
+	// The URL is locked while its percentages are checked and the status is inserted
+	var createdStatus crud.Row
+	err = crud.WithTx(r.Context(), func(tx *crud.Tx) error {
+		if err := tx.Lock("url_config", status.URLID); err != nil {
+			return err
+		}
+		if err := validatePercentageDistribution(tx, status.URLID, status.VariantID, status.Percentage, 0); err != nil {
+			return err
+		}
+
+		trailers, earlyHints := protocolOptionValues(status.Trailers, status.EarlyHints)
+		columns := []string{"url_id", "http_status", "percentage", "variant_id", "trailers", "early_hints"}
+		values := []interface{}{status.URLID, status.HTTPStatus, status.Percentage, status.VariantID, trailers, earlyHints}
+		var err error
+		createdStatus, err = tx.CreateAudited(ownerID, "url_http_status", columns, values) // Fetch the created object
+		return err
+	})
+	if isValidationError(err) {
+		response.SendResponse(w, http.StatusBadRequest, "Percentage validation failed", err.Error(), nil, false)
+		return
+	}
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to create HTTP status", err.Error(), nil, false)
+		sendServerError(w, "Failed to create HTTP status", err)
 		return
 	}
 
 	response.SendResponse(w, http.StatusCreated, "HTTP status created successfully", "", createdStatus, false)
 }
 
+var urlHTTPStatusListSpec = listSpec{
+	table:       "url_http_status",
+	name:        "HTTP statuses",
+	filterable:  []string{"url_id", "http_status", "variant_id"},
+	sortable:    []string{"id", "http_status", "percentage", "created_at", "updated_at"},
+	defaultSort: []crud.SortField{{Column: "id"}},
+	scoped:      true,
+}
+
 // GetAllURLHTTPStatusesHandler retrieves all HTTP statuses from the database
 func GetAllURLHTTPStatusesHandler(w http.ResponseWriter, r *http.Request) {
-	filters := map[string]interface{}{} // No filters, get all HTTP statuses
-	results, err := crud.List("url_http_status", filters)
+	sendList(w, r, urlHTTPStatusListSpec, nil, "HTTP statuses retrieved successfully")
+}
+
+func UpdateURLHTTPStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromVars(r, "id")
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to retrieve HTTP statuses", err.Error(), nil, false)
+		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
 		return
 	}
 
-	response.SendResponse(w, http.StatusOK, "HTTP statuses retrieved successfully", "", results, false)
-}
-
-func UpdateURLHTTPStatusHandler(w http.ResponseWriter, r *http.Request) {
 	var status URLHTTPStatus
-	err := json.NewDecoder(r.Body).Decode(&status)
+	err = json.NewDecoder(r.Body).Decode(&status)
 	if err != nil {
 		response.SendResponse(w, http.StatusBadRequest, "Invalid request payload", err.Error(), nil, false)
 		return
@@ -188,27 +260,56 @@ func UpdateURLHTTPStatusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Authorize ownership of the URL
-	if err := authorizeURLOwnership(status.URLID, ownerID); err != nil {
-		response.SendResponse(w, http.StatusUnauthorized, err.Error(), "", nil, false)
+	// Authorize ownership of the HTTP status being updated and of the URL it points to
+	if err := authorizeURLHTTPStatusOwnership(r.Context(), id, ownerID); err != nil {
+		sendAuthorizationError(w, err)
+		return
+	}
+	if err := authorizeURLOwnership(r.Context(), status.URLID, ownerID); err != nil {
+		sendAuthorizationError(w, err)
 		return
 	}
 
-	// Validate percentage distribution
-	if err := validatePercentageDistribution(status.URLID, status.Percentage); err != nil {
-		response.SendResponse(w, http.StatusBadRequest, "Percentage validation failed", err.Error(), nil, false)
+	if err := validateStatusVariant(r.Context(), status.URLID, status.VariantID); err != nil {
+		response.SendResponse(w, http.StatusBadRequest, "Invalid variant_id", err.Error(), nil, false)
 		return
 	}
 
-	// Update the HTTP status in the database
-	updates := map[string]interface{}{
-		"url_id":      status.URLID,
-		"http_status": status.HTTPStatus,
-		"percentage":  status.Percentage,
+	// Both the URL the status belongs to and the one it moves to are locked while their percentages are checked
+	var updatedStatus crud.Row
+	err = crud.WithTx(r.Context(), func(tx *crud.Tx) error {
+		current, err := tx.Read("url_http_status", id)
+		if err != nil {
+			return err
+		}
+		if err := lockRecords(tx, "url_config", current.Int64("url_id"), status.URLID); err != nil {
+			return err
+		}
+
+		// Validate percentage distribution
+		if err := validatePercentageDistribution(tx, status.URLID, status.VariantID, status.Percentage, id); err != nil {
+			return err
+		}
+
+		// Update the HTTP status in the database
+		trailers, earlyHints := protocolOptionValues(status.Trailers, status.EarlyHints)
+		updates := map[string]interface{}{
+			"url_id":      status.URLID,
+			"http_status": status.HTTPStatus,
+			"percentage":  status.Percentage,
+			"variant_id":  status.VariantID,
+			"trailers":    trailers,
+			"early_hints": earlyHints,
+		}
+		updatedStatus, err = tx.UpdateAudited(ownerID, "url_http_status", id, updates) // Fetch the updated object
+		return err
+	})
+	if isValidationError(err) {
+		response.SendResponse(w, http.StatusBadRequest, "Percentage validation failed", err.Error(), nil, false)
+		return
 	}
-	updatedStatus, err := crud.Update("url_http_status", status.ID, updates) // Fetch the updated object
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to update HTTP status", err.Error(), nil, false)
+		sendServerError(w, "Failed to update HTTP status", err)
 		return
 	}
 
@@ -217,16 +318,28 @@ func UpdateURLHTTPStatusHandler(w http.ResponseWriter, r *http.Request) {
 
 // DeleteURLHTTPStatusHandler handles deleting an HTTP status
 func DeleteURLHTTPStatusHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := getIDFromVars(r, "id")
 	if err != nil {
 		response.SendResponse(w, http.StatusBadRequest, "Invalid ID parameter", err.Error(), nil, false)
 		return
 	}
 
-	err = crud.Delete("url_http_status", id)
+	// Extract the owner ID from the context (injected by the JWT middleware)
+	ownerID, err := authz.AccountID(r)
+	if err != nil {
+		response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: Owner ID not found", "", nil, false)
+		return
+	}
+
+	// Authorize ownership of the HTTP status
+	if err := authorizeURLHTTPStatusOwnership(r.Context(), id, ownerID); err != nil {
+		sendAuthorizationError(w, err)
+		return
+	}
+
+	err = crud.DeleteAudited(r.Context(), ownerID, "url_http_status", id)
 	if err != nil {
-		response.SendResponse(w, http.StatusInternalServerError, "Failed to delete HTTP status", err.Error(), nil, false)
+		sendServerError(w, "Failed to delete HTTP status", err)
 		return
 	}
 
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/adolfooes/api_faker/config"
+)
+
+// CORSMiddleware lets browsers on the allowed origins call the API. It answers the preflight requests
+// itself, and does nothing when no origin is allowed.
+func CORSMiddleware(next http.Handler) http.Handler {
+	cors := config.GetCORS()
+	if len(cors.AllowedOrigins) == 0 {
+		return next
+	}
+
+	anyOrigin := slices.Contains(cors.AllowedOrigins, "*")
+	allowedMethods := strings.Join(cors.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(cors.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(cors.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cors.MaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || (!anyOrigin && !slices.Contains(cors.AllowedOrigins, origin)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		if anyOrigin {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cors.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		// A preflight asks whether the actual request may be sent, it never reaches the routes
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			header.Set("Access-Control-Allow-Methods", allowedMethods)
+			header.Set("Access-Control-Allow-Headers", allowedHeaders)
+			header.Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if exposedHeaders != "" {
+			header.Set("Access-Control-Expose-Headers", exposedHeaders)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/adolfooes/api_faker/internal/logging"
+	"github.com/adolfooes/api_faker/internal/metrics"
+)
+
+// RequestIDHeader carries the ID of a request, from the client or a proxy, and back in the response
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request IDs accepted from clients, longer ones are replaced
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware propagates the X-Request-ID of the request, or generates one, into the
+// context for the logs and into the response header
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), requestID)))
+	})
+}
+
+// validRequestID reports whether a request ID sent by a client can be logged as it is
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit request ID
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// probePaths are polled by orchestrators every few seconds, so their successes are only logged at the debug level
+var probePaths = map[string]bool{"/healthz": true, "/readyz": true}
+
+// accessRecorder wraps a response writer to remember what was sent, for the access log
+type accessRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	errorDetail string
+}
+
+func (r *accessRecorder) WriteHeader(status int) {
+	// Informational statuses, like 103 Early Hints, come before the status of the response
+	if r.status == 0 && !metrics.IsInformational(status) {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *accessRecorder) Write(body []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(body)
+	r.bytes += n
+	return n, err
+}
+
+// RecordErrorDetail keeps the internal error detail of the response, which is logged even when it isn't sent
+func (r *accessRecorder) RecordErrorDetail(detail string) {
+	r.errorDetail = detail
+}
+
+// Unwrap returns the wrapped writer, so http.ResponseController reaches its flush and deadline methods
+func (r *accessRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// AccessLogMiddleware logs every request with its status, size and latency. Server errors are logged at the error level.
+func AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &accessRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		} else if probePaths[r.URL.Path] && status < http.StatusBadRequest {
+			level = slog.LevelDebug
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", recorder.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("user_agent", r.UserAgent()),
+		}
+		if recorder.errorDetail != "" {
+			attrs = append(attrs, slog.String("error", recorder.errorDetail))
+		}
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
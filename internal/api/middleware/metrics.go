@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/adolfooes/api_faker/internal/metrics"
+	"github.com/gorilla/mux"
+)
+
+// MetricsMiddleware counts and times the requests, labelled by the template of the matched route
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := metrics.NewResponseRecorder(w)
+
+		next.ServeHTTP(recorder, r)
+
+		// Label with the template rather than the path, so ids don't create a series per record
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		metrics.ObserveHTTPRequest(route, r.Method, recorder.Status(), time.Since(start))
+	})
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -9,10 +10,15 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/api/authz"
+	"github.com/adolfooes/api_faker/internal/db"
+	"github.com/adolfooes/api_faker/internal/mockcache"
+	"github.com/adolfooes/api_faker/internal/repository"
+	"github.com/adolfooes/api_faker/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
-var jwtSecretKey = []byte("your_secret_key") // Same secret key
-
 // Key to use when setting the account ID in context
 type contextKey string
 
@@ -31,28 +37,51 @@ func JWTMiddleware(next http.Handler) http.Handler {
 		// Define a struct to store claims
 		claims := jwt.MapClaims{}
 
+		_, span := tracing.Start(r.Context(), "jwt.validate")
+
 		// Parse the token
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 			// Ensure that the method used for signing is HMAC
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, http.ErrUseLastResponse
 			}
-			return jwtSecretKey, nil
+			return config.GetJWTSecretKey(), nil
 		})
 
 		// Handle invalid tokens or errors
 		if err != nil || !token.Valid {
+			span.SetStatus(codes.Error, "invalid token")
+			span.End()
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
 		var accountID string
-		if id, ok := claims["account_id"].(float64); ok {
+		id, ok := claims["account_id"].(float64)
+		if ok {
 			accountID = strconv.FormatInt(int64(id), 10)
 		} else {
+			span.SetStatus(codes.Error, "account ID not found in token")
+			span.End()
 			http.Error(w, "Account ID not found in token or not a float64", http.StatusUnauthorized)
 			return
 		}
+		span.SetAttributes(attribute.String("enduser.id", accountID))
+		span.End()
+
+		// Tokens stop working as soon as their account is deactivated or deleted, not when they expire.
+		// The status is cached, so authenticated requests like mock requests don't read the account every time
+		canSignIn, err := mockcache.Accounts().CanSignIn(r.Context(), int64(id))
+		if err == nil && !canSignIn {
+			http.Error(w, "Account is inactive or no longer exists", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			if !db.IsCanceled(err) {
+				http.Error(w, "Failed to check account", accountErrorStatus(err))
+			}
+			return
+		}
 
 		// Inject the account ID into the request's context
 		ctx := context.WithValue(r.Context(), config.JWTAccountIDKey, accountID)
@@ -62,3 +91,41 @@ func JWTMiddleware(next http.Handler) http.Handler {
 
 	})
 }
+
+// accountErrorStatus returns the status of a request whose account couldn't be read: 504 when the database
+// timed out, 503 when it is unavailable, and 500 otherwise
+func accountErrorStatus(err error) int {
+	switch {
+	case db.IsTimeout(err):
+		return http.StatusGatewayTimeout
+	case db.IsUnavailable(err):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// AdminMiddleware only lets active admins through; it must run after JWTMiddleware
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accountID, err := authz.AccountID(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// A missing account is refused like a user, a failed lookup is a server error
+		isAdmin, err := authz.IsAdmin(r.Context(), accountID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			if !db.IsCanceled(err) {
+				http.Error(w, "Failed to check account", accountErrorStatus(err))
+			}
+			return
+		}
+		if !isAdmin {
+			http.Error(w, "Forbidden: admin access required", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
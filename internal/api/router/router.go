@@ -1,6 +1,8 @@
 package router
 
 import (
+	"net/http"
+
 	"github.com/adolfooes/api_faker/internal/api/handler"
 	"github.com/adolfooes/api_faker/internal/api/middleware"
 	"github.com/gorilla/mux"
@@ -9,26 +11,86 @@ import (
 // InitializeRouter initializes the API routes
 func InitializeRouter() *mux.Router {
 	router := mux.NewRouter()
+	router.Use(middleware.TracingMiddleware) // Trace every matched request, joining the trace of the caller
+	router.Use(middleware.MetricsMiddleware) // Count and time every matched request
+
+	// Liveness, readiness and build information, for probes and deployments
+	router.HandleFunc("/healthz", handler.HealthzHandler).Methods("GET")
+	router.HandleFunc("/readyz", handler.ReadyzHandler).Methods("GET")
+	router.HandleFunc("/version", handler.VersionHandler).Methods("GET")
+
+	// Certificate of the CA issuing the TLS certificates, in auto TLS mode
+	router.HandleFunc("/tls/ca.crt", handler.CACertificateHandler).Methods("GET")
 
 	// Public route (login)
 	router.HandleFunc("/login", handler.LoginHandler).Methods("POST")
 	router.HandleFunc("/account", handler.CreateAccountHandler).Methods("POST")
+	router.HandleFunc("/account/verify", handler.VerifyEmailHandler).Methods("GET", "POST")
+	router.HandleFunc("/account/verify/resend", handler.ResendVerificationHandler).Methods("POST")
+	router.HandleFunc("/account/email/confirm", handler.ConfirmEmailChangeHandler).Methods("GET", "POST")
+	router.HandleFunc("/password/forgot", handler.ForgotPasswordHandler).Methods("POST")
+	router.HandleFunc("/password/reset", handler.ResetPasswordHandler).Methods("POST")
+
+	// Public OIDC identity provider routes, one issuer per project
+	router.HandleFunc("/oidc/{project_id:[0-9]+}/.well-known/openid-configuration", handler.OIDCDiscoveryHandler).Methods("GET")
+	router.HandleFunc("/oidc/{project_id:[0-9]+}/jwks.json", handler.OIDCJWKSHandler).Methods("GET")
+	router.HandleFunc("/oidc/{project_id:[0-9]+}/authorize", handler.OIDCAuthorizeHandler).Methods("GET", "POST")
+	router.HandleFunc("/oidc/{project_id:[0-9]+}/token", handler.OIDCTokenHandler).Methods("POST")
+	router.HandleFunc("/oidc/{project_id:[0-9]+}/userinfo", handler.OIDCUserInfoHandler).Methods("GET", "POST")
 
 	// Protected routes
 	securedRoutes := router.PathPrefix("/api").Subrouter()
 	securedRoutes.Use(middleware.JWTMiddleware) // Apply JWT middleware
 
-	// Account-related routes under /api
+	// Account-related routes under /api (self-service, admins can manage every account)
 	securedRoutes.HandleFunc("/account/{id:[0-9]+}", handler.GetAccountHandler).Methods("GET")
 	securedRoutes.HandleFunc("/account/{id:[0-9]+}", handler.UpdateAccountHandler).Methods("PUT")
 	securedRoutes.HandleFunc("/account/{id:[0-9]+}", handler.DeleteAccountHandler).Methods("DELETE")
 
+	// Admin-only account management routes under /api
+	securedRoutes.Handle("/account", adminOnly(handler.GetAllAccountsHandler)).Methods("GET")
+	securedRoutes.Handle("/account/{id:[0-9]+}/activate", adminOnly(handler.ActivateAccountHandler)).Methods("PUT")
+	securedRoutes.Handle("/account/{id:[0-9]+}/deactivate", adminOnly(handler.DeactivateAccountHandler)).Methods("PUT")
+	securedRoutes.Handle("/account/{id:[0-9]+}/role", adminOnly(handler.UpdateAccountRoleHandler)).Methods("PUT")
+	securedRoutes.Handle("/account/{id:[0-9]+}/lockout", adminOnly(handler.GetAccountLockoutHandler)).Methods("GET")
+	securedRoutes.Handle("/account/{id:[0-9]+}/lockout", adminOnly(handler.ClearAccountLockoutHandler)).Methods("DELETE")
+
 	// Project-related routes under /api
 	securedRoutes.HandleFunc("/project", handler.GetAllProjectsHandler).Methods("GET")
 	securedRoutes.HandleFunc("/project/{id:[0-9]+}", handler.GetProjectHandler).Methods("GET")
 	securedRoutes.HandleFunc("/project", handler.CreateProjectHandler).Methods("POST")
 	securedRoutes.HandleFunc("/project/{id:[0-9]+}", handler.UpdateProjectHandler).Methods("PUT")
 	securedRoutes.HandleFunc("/project/{id:[0-9]+}", handler.DeleteProjectHandler).Methods("DELETE")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/clone", handler.CloneProjectHandler).Methods("POST")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/audit", handler.GetProjectAuditLogHandler).Methods("GET")
+
+	// Nested endpoint routes (URL config, statuses and models in one document) under /api
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/endpoints", handler.GetAllEndpointsHandler).Methods("GET")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/endpoints", handler.CreateEndpointHandler).Methods("POST")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/endpoints/{url_id:[0-9]+}", handler.GetEndpointHandler).Methods("GET")
+
+	// Project variant routes under /api
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/variants", handler.GetAllProjectVariantsHandler).Methods("GET")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/variants", handler.CreateProjectVariantHandler).Methods("POST")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/variants/{variant_id:[0-9]+}", handler.UpdateProjectVariantHandler).Methods("PUT")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/variants/{variant_id:[0-9]+}", handler.DeleteProjectVariantHandler).Methods("DELETE")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/active_variant", handler.SetActiveVariantHandler).Methods("PUT")
+
+	// Client certificate (mTLS) routes under /api
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/client_certificates", handler.CreateClientCertificateHandler).Methods("POST")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/client_cert_requirement", handler.SetClientCertRequirementHandler).Methods("PUT")
+
+	// Protocol (HTTP/1.1, HTTP/2, h2c) routes under /api
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/protocols", handler.SetProjectProtocolsHandler).Methods("PUT")
+
+	// OIDC identity provider configuration routes under /api
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/oidc/clients", handler.GetAllOIDCClientsHandler).Methods("GET")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/oidc/clients", handler.CreateOIDCClientHandler).Methods("POST")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/oidc/clients/{client_id:[0-9]+}", handler.DeleteOIDCClientHandler).Methods("DELETE")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/oidc/users", handler.GetAllOIDCUsersHandler).Methods("GET")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/oidc/users", handler.CreateOIDCUserHandler).Methods("POST")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/oidc/users/{user_id:[0-9]+}", handler.UpdateOIDCUserHandler).Methods("PUT")
+	securedRoutes.HandleFunc("/project/{id:[0-9]+}/oidc/users/{user_id:[0-9]+}", handler.DeleteOIDCUserHandler).Methods("DELETE")
 
 	// URL Config-related routes under /api
 	securedRoutes.HandleFunc("/url_config", handler.GetAllURLConfigsHandler).Methods("GET")
@@ -49,8 +111,21 @@ func InitializeRouter() *mux.Router {
 	securedRoutes.HandleFunc("/response_model/{id:[0-9]+}", handler.UpdateResponseModelHandler).Methods("PUT")
 	securedRoutes.HandleFunc("/response_model/{id:[0-9]+}", handler.DeleteResponseModelHandler).Methods("DELETE")
 
+	// Revision history routes of the versioned resources under /api
+	for _, table := range []string{"response_model", "url_config", "url_http_status"} {
+		securedRoutes.HandleFunc("/"+table+"/{id:[0-9]+}/revisions", handler.ListRevisionsHandler(table)).Methods("GET")
+		securedRoutes.HandleFunc("/"+table+"/{id:[0-9]+}/revisions/diff", handler.DiffRevisionsHandler(table)).Methods("GET")
+		securedRoutes.HandleFunc("/"+table+"/{id:[0-9]+}/revisions/{version:[0-9]+}", handler.GetRevisionHandler(table)).Methods("GET")
+		securedRoutes.HandleFunc("/"+table+"/{id:[0-9]+}/revisions/{version:[0-9]+}/rollback", handler.RollbackRevisionHandler(table)).Methods("POST")
+	}
+
 	// Mock response route under /api
 	securedRoutes.HandleFunc("/mock/{project_id}/{path:.*}", handler.MockHandler).Methods("GET", "POST", "PUT", "DELETE", "PATCH")
 
 	return router
 }
+
+// adminOnly wraps a handler so only admins can reach it
+func adminOnly(handlerFunc http.HandlerFunc) http.Handler {
+	return middleware.AdminMiddleware(handlerFunc)
+}
@@ -1,9 +1,14 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"log/slog"
+	"time"
 
+	"github.com/adolfooes/api_faker/config"
 	_ "github.com/lib/pq" // PostgreSQL driver
 
 	"github.com/golang-migrate/migrate/v4"
@@ -13,44 +18,113 @@ import (
 
 var db *sql.DB
 
-// InitDB initializes the database connection using a provided connection string
-func InitDB(connStr string) {
+// Backoff between the attempts to reach the database at startup
+const (
+	initialConnectBackoff = 500 * time.Millisecond
+	maxConnectBackoff     = 10 * time.Second
+)
+
+// migratedVersion is the schema version the migrations brought the database to at startup
+var migratedVersion uint
+
+// InitDB initializes the database connection using a provided connection string. A database that
+// isn't reachable yet is retried with an exponential backoff for up to DB_CONNECT_TIMEOUT.
+func InitDB(connStr string) error {
 	var err error
 
 	db, err = sql.Open("postgres", connStr)
 	if err != nil {
-		log.Fatalf("Error opening the database: %v", err)
+		return fmt.Errorf("error opening the database: %w", err)
 	}
 
+	// Size the pool so bursts of requests reuse connections instead of opening new ones
+	db.SetMaxOpenConns(config.GetDBMaxOpenConns())
+	db.SetMaxIdleConns(config.GetDBMaxIdleConns())
+	db.SetConnMaxLifetime(config.GetDBConnMaxLifetime())
+	db.SetConnMaxIdleTime(config.GetDBConnMaxIdleTime())
+
 	// Verify the connection with the database
-	err = db.Ping()
-	if err != nil {
-		log.Fatalf("Error connecting to the database: %v", err)
+	if err := waitForDB(config.GetDBConnectTimeout()); err != nil {
+		return err
 	}
 
-	log.Println("Database connection established successfully")
+	slog.Info("Database connection established successfully")
+	return nil
 }
 
-func RunMigrations(connStr string) {
-	log.Println("Starting migrations...")
+// waitForDB pings the database until it answers, backing off between attempts, or until timeout has passed
+func waitForDB(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := initialConnectBackoff
+
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := WithQueryTimeout(context.Background())
+		err := db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("error connecting to the database after %d attempts: %w", attempt, err)
+		}
+		slog.Warn("Database not reachable yet, retrying", "attempt", attempt, "retry_in", backoff.String(), "error", err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+}
+
+// RunMigrations brings the database schema to the latest version of the migrations
+func RunMigrations(connStr string) error {
+	slog.Info("Starting migrations")
 
 	// Initialize the migration
 	m, err := migrate.New(
-		"file:///migrations", // Path to your migration files
+		"file://"+config.GetMigrationsDir(),
 		connStr,
 	)
-
 	if err != nil {
-		log.Fatalf("Failed to initialize migration: %v", err)
+		return fmt.Errorf("failed to initialize migration: %w", err)
 	}
+	defer m.Close()
 
 	// Apply all migrations
 	err = m.Up()
 	if err != nil && err != migrate.ErrNoChange {
-		log.Fatalf("Migration failed: %v", err)
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	version, _, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return fmt.Errorf("failed to read the migration version: %w", err)
 	}
+	migratedVersion = version
 
-	log.Println("Migrations completed successfully.")
+	slog.Info("Migrations completed successfully", "version", version)
+	return nil
+}
+
+// MigratedVersion returns the schema version the database was migrated to at startup
+func MigratedVersion() uint {
+	return migratedVersion
+}
+
+// SchemaVersion returns the current schema version of the database, and whether its last migration
+// failed halfway through (dirty)
+func SchemaVersion(ctx context.Context) (uint, bool, error) {
+	ctx, cancel := WithQueryTimeout(ctx)
+	defer cancel()
+
+	var version int64
+	var dirty bool
+	err := GetDB().QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("error reading the schema version: %w", err)
+	}
+	return uint(version), dirty, nil
 }
 
 // GetDB returns the database instance
@@ -60,3 +134,11 @@ func GetDB() *sql.DB {
 	}
 	return db
 }
+
+// Close closes the connections of the pool, once the server doesn't serve requests anymore
+func Close() error {
+	if db == nil {
+		return nil
+	}
+	return db.Close()
+}
@@ -1,5 +1,7 @@
 package db
 
+import "sort"
+
 // Define ENUM mappings for different tables and columns.
 // Now that ENUM values in PostgreSQL are stored as strings, we map them directly as string-to-string.
 var enumMappings = map[string]map[string]map[string]string{
@@ -14,6 +16,38 @@ var enumMappings = map[string]map[string]map[string]string{
 			"HEAD":    "HEAD",
 		},
 	},
+	"project": {
+		"type": {
+			"mock": "mock",
+			"oidc": "oidc",
+		},
+	},
+	"account": {
+		"role": {
+			"user":  "user",
+			"admin": "admin",
+		},
+	},
+	"account_token": {
+		"purpose": {
+			"email_verification": "email_verification",
+			"password_reset":     "password_reset",
+			"email_change":       "email_change",
+		},
+	},
+	"security_event": {
+		"event": {
+			"lockout":         "lockout",
+			"lockout_cleared": "lockout_cleared",
+		},
+	},
+	"audit_log": {
+		"action": {
+			"create": "create",
+			"update": "update",
+			"delete": "delete",
+		},
+	},
 	"project_users": {
 		"access_level": {
 			"read":  "Read",
@@ -28,6 +62,30 @@ func ConvertASCIIToString(asciiCodes []byte) string {
 	return string(asciiCodes)
 }
 
+// IsEnumValue reports whether value is a valid value of an enum column. Columns without a mapping accept any value.
+func IsEnumValue(table string, column string, value string) bool {
+	columnEnums, ok := enumMappings[table][column]
+	if !ok {
+		return true
+	}
+	_, ok = columnEnums[value]
+	return ok
+}
+
+// EnumValues returns the sorted values of an enum column, or nil when the column has no mapping
+func EnumValues(table string, column string) []string {
+	columnEnums := enumMappings[table][column]
+	if columnEnums == nil {
+		return nil
+	}
+	values := make([]string, 0, len(columnEnums))
+	for value := range columnEnums {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
 func TranslateEnumValue(table string, column string, value interface{}) interface{} {
 	if tableEnums, tableExists := enumMappings[table]; tableExists {
 		if columnEnums, columnExists := tableEnums[column]; columnExists {
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/adolfooes/api_faker/config"
+	"github.com/lib/pq"
+)
+
+// WithQueryTimeout bounds a query by the configured query timeout, on top of the deadline
+// or cancellation of ctx (usually the context of the HTTP request)
+func WithQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, config.GetDBQueryTimeout())
+}
+
+// IsTimeout reports whether the query failed because it ran out of time
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	// The server cancelled the statement, either on its own statement_timeout or on our request after the deadline
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014"
+}
+
+// IsCanceled reports whether the query failed because its context was cancelled, usually because the client went away
+func IsCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// IsUnavailable reports whether the query failed because the database can't be reached or can't take more work
+func IsUnavailable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// Connection exceptions (08), insufficient resources (53) and server shutdowns (57P01-57P03)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		code := string(pqErr.Code)
+		return strings.HasPrefix(code, "08") || strings.HasPrefix(code, "53") || strings.HasPrefix(code, "57P")
+	}
+	return false
+}
+
+// IsUniqueViolation reports whether the statement failed because it would duplicate a unique value
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// ViolatedConstraint returns the name of the constraint the statement violated, or "" when it didn't violate one
+func ViolatedConstraint(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Constraint
+	}
+	return ""
+}
@@ -0,0 +1,19 @@
+-- Drop triggers
+DROP TRIGGER IF EXISTS trigger_oidc_client_updated_at ON oidc_client;
+DROP TRIGGER IF EXISTS trigger_oidc_user_updated_at ON oidc_user;
+
+-- Drop trigger functions
+DROP FUNCTION IF EXISTS update_oidc_client_updated_at;
+DROP FUNCTION IF EXISTS update_oidc_user_updated_at;
+
+-- Drop the OIDC tables
+DROP TABLE IF EXISTS oidc_authorization_code;
+DROP TABLE IF EXISTS oidc_user;
+DROP TABLE IF EXISTS oidc_client;
+DROP TABLE IF EXISTS oidc_signing_key;
+
+-- Drop the type column from the project table
+ALTER TABLE project DROP COLUMN IF EXISTS type;
+
+-- Drop the ENUM type for project types
+DROP TYPE IF EXISTS project_type_enum;
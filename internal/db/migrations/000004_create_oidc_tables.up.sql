@@ -0,0 +1,87 @@
+-- Define the ENUM type for project types
+CREATE TYPE project_type_enum AS ENUM ('mock', 'oidc');
+
+-- Add the type column to the project table
+ALTER TABLE project ADD COLUMN type project_type_enum NOT NULL DEFAULT 'mock';
+
+-- Create the oidc_signing_key table (one RSA key per project)
+CREATE TABLE oidc_signing_key (
+    project_id INT PRIMARY KEY,
+    kid VARCHAR(64) NOT NULL,
+    private_key TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (project_id) REFERENCES project(id) ON DELETE CASCADE
+);
+
+-- Create the oidc_client table
+CREATE TABLE oidc_client (
+    id SERIAL PRIMARY KEY,
+    project_id INT NOT NULL,
+    client_id VARCHAR(255) NOT NULL,
+    client_secret VARCHAR(255) NOT NULL,
+    redirect_uris JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (project_id, client_id),
+    FOREIGN KEY (project_id) REFERENCES project(id) ON DELETE CASCADE
+);
+
+-- Create the oidc_user table
+CREATE TABLE oidc_user (
+    id SERIAL PRIMARY KEY,
+    project_id INT NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    claims JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (project_id, username),
+    FOREIGN KEY (project_id) REFERENCES project(id) ON DELETE CASCADE
+);
+
+-- Create the oidc_authorization_code table
+CREATE TABLE oidc_authorization_code (
+    code VARCHAR(128) PRIMARY KEY,
+    project_id INT NOT NULL,
+    client_id VARCHAR(255) NOT NULL,
+    user_id INT NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    scope TEXT,
+    nonce TEXT,
+    code_challenge TEXT,
+    code_challenge_method VARCHAR(16),
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (project_id) REFERENCES project(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES oidc_user(id) ON DELETE CASCADE
+);
+
+-- Create trigger function to update 'updated_at' on row update for oidc_client
+CREATE OR REPLACE FUNCTION update_oidc_client_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+   NEW.updated_at = NOW();
+   RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger function to update 'updated_at' on row update for oidc_user
+CREATE OR REPLACE FUNCTION update_oidc_user_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+   NEW.updated_at = NOW();
+   RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create triggers for the oidc_client table
+CREATE TRIGGER trigger_oidc_client_updated_at
+BEFORE UPDATE ON oidc_client
+FOR EACH ROW
+EXECUTE FUNCTION update_oidc_client_updated_at();
+
+-- Create triggers for the oidc_user table
+CREATE TRIGGER trigger_oidc_user_updated_at
+BEFORE UPDATE ON oidc_user
+FOR EACH ROW
+EXECUTE FUNCTION update_oidc_user_updated_at();
@@ -0,0 +1,11 @@
+-- Drop the index
+DROP INDEX IF EXISTS idx_account_token_account_purpose;
+
+-- Drop the account_token table
+DROP TABLE IF EXISTS account_token;
+
+-- Drop the email verification column
+ALTER TABLE account DROP COLUMN IF EXISTS email_verified_at;
+
+-- Drop the ENUM type for account token purposes
+DROP TYPE IF EXISTS account_token_purpose_enum;
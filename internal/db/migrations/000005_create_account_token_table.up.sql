@@ -0,0 +1,23 @@
+-- Define the ENUM type for account token purposes
+CREATE TYPE account_token_purpose_enum AS ENUM ('email_verification', 'password_reset');
+
+-- Track when the account email was verified
+ALTER TABLE account ADD COLUMN email_verified_at TIMESTAMP NULL;
+
+-- Accounts created before verification existed are considered verified
+UPDATE account SET email_verified_at = created_at WHERE is_active = TRUE;
+
+-- Create the account_token table for single-use, expiring tokens
+CREATE TABLE account_token (
+    id SERIAL PRIMARY KEY,
+    account_id INT NOT NULL,
+    purpose account_token_purpose_enum NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (account_id) REFERENCES account(id) ON DELETE CASCADE
+);
+
+-- Create an index on account_token (account_id, purpose)
+CREATE INDEX idx_account_token_account_purpose ON account_token (account_id, purpose);
@@ -0,0 +1,9 @@
+-- Drop the index
+DROP INDEX IF EXISTS idx_security_event_account;
+
+-- Drop the security_event and login_throttle tables
+DROP TABLE IF EXISTS security_event;
+DROP TABLE IF EXISTS login_throttle;
+
+-- Drop the ENUM type for security events
+DROP TYPE IF EXISTS security_event_enum;
@@ -0,0 +1,27 @@
+-- Create the login_throttle table with failed login counters per email and per IP
+CREATE TABLE login_throttle (
+    key VARCHAR(320) PRIMARY KEY,
+    failed_attempts INT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP NULL,
+    last_failed_at TIMESTAMP NULL
+);
+
+-- Define the ENUM type for security events
+CREATE TYPE security_event_enum AS ENUM ('lockout', 'lockout_cleared');
+
+-- Create the security_event table to audit lockouts
+CREATE TABLE security_event (
+    id SERIAL PRIMARY KEY,
+    event security_event_enum NOT NULL,
+    account_id INT NULL,
+    throttle_key VARCHAR(320) NOT NULL,
+    ip_address VARCHAR(64),
+    actor_id INT NULL,
+    details TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (account_id) REFERENCES account(id) ON DELETE SET NULL,
+    FOREIGN KEY (actor_id) REFERENCES account(id) ON DELETE SET NULL
+);
+
+-- Create an index on security_event (account_id)
+CREATE INDEX idx_security_event_account ON security_event (account_id);
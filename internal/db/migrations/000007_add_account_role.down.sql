@@ -0,0 +1,5 @@
+-- Drop the role column from the account table
+ALTER TABLE account DROP COLUMN IF EXISTS role;
+
+-- Drop the ENUM type for account roles
+DROP TYPE IF EXISTS account_role_enum;
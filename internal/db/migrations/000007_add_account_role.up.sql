@@ -0,0 +1,5 @@
+-- Define the ENUM type for account roles
+CREATE TYPE account_role_enum AS ENUM ('user', 'admin');
+
+-- Add the role column to the account table
+ALTER TABLE account ADD COLUMN role account_role_enum NOT NULL DEFAULT 'user';
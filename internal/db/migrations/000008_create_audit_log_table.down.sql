@@ -0,0 +1,8 @@
+-- Drop the index
+DROP INDEX IF EXISTS idx_audit_log_project_created;
+
+-- Drop the audit_log table
+DROP TABLE IF EXISTS audit_log;
+
+-- Drop the ENUM type for audited actions
+DROP TYPE IF EXISTS audit_action_enum;
@@ -0,0 +1,19 @@
+-- Define the ENUM type for audited actions
+CREATE TYPE audit_action_enum AS ENUM ('create', 'update', 'delete');
+
+-- Create the audit_log table; project_id has no foreign key so history survives project deletion
+CREATE TABLE audit_log (
+    id SERIAL PRIMARY KEY,
+    project_id INT NULL,
+    actor_id INT NULL,
+    table_name VARCHAR(64) NOT NULL,
+    record_id INT NOT NULL,
+    action audit_action_enum NOT NULL,
+    before JSONB NULL,
+    after JSONB NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (actor_id) REFERENCES account(id) ON DELETE SET NULL
+);
+
+-- Create an index on audit_log (project_id, created_at)
+CREATE INDEX idx_audit_log_project_created ON audit_log (project_id, created_at);
@@ -0,0 +1,8 @@
+-- Drop triggers
+DROP TRIGGER IF EXISTS trigger_revision_immutable ON revision;
+
+-- Drop trigger functions
+DROP FUNCTION IF EXISTS prevent_revision_update;
+
+-- Drop the revision table
+DROP TABLE IF EXISTS revision;
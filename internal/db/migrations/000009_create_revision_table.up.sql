@@ -0,0 +1,26 @@
+-- Create the revision table with immutable snapshots of versioned records
+CREATE TABLE revision (
+    id SERIAL PRIMARY KEY,
+    table_name VARCHAR(64) NOT NULL,
+    record_id INT NOT NULL,
+    version INT NOT NULL,
+    data JSONB NOT NULL,
+    actor_id INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (table_name, record_id, version),
+    FOREIGN KEY (actor_id) REFERENCES account(id) ON DELETE SET NULL
+);
+
+-- Create trigger function that rejects changes to existing revisions
+CREATE OR REPLACE FUNCTION prevent_revision_update()
+RETURNS TRIGGER AS $$
+BEGIN
+   RAISE EXCEPTION 'revisions are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create triggers for the revision table
+CREATE TRIGGER trigger_revision_immutable
+BEFORE UPDATE ON revision
+FOR EACH ROW
+EXECUTE FUNCTION prevent_revision_update();
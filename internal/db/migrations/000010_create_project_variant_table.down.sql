@@ -0,0 +1,10 @@
+-- Drop the variant columns
+ALTER TABLE project DROP COLUMN IF EXISTS active_variant_id;
+ALTER TABLE url_http_status DROP COLUMN IF EXISTS variant_id;
+
+-- Drop the triggers and trigger function
+DROP TRIGGER IF EXISTS trigger_project_variant_updated_at ON project_variant;
+DROP FUNCTION IF EXISTS update_project_variant_updated_at();
+
+-- Drop the project_variant table
+DROP TABLE IF EXISTS project_variant;
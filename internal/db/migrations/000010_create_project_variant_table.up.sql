@@ -0,0 +1,37 @@
+-- Create the project_variant table with the named response variants of a project
+CREATE TABLE project_variant (
+    id SERIAL PRIMARY KEY,
+    project_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    fallback_http_status INT NULL CHECK (fallback_http_status BETWEEN 100 AND 599), -- Served by URLs without statuses of their own in the variant
+    fallback_model JSONB NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (project_id, name),
+    FOREIGN KEY (project_id) REFERENCES project(id) ON DELETE CASCADE
+);
+
+-- Statuses without a variant are the project's default responses
+ALTER TABLE url_http_status ADD COLUMN variant_id INT NULL REFERENCES project_variant(id) ON DELETE CASCADE;
+
+-- The variant served when the client doesn't select one
+ALTER TABLE project ADD COLUMN active_variant_id INT NULL REFERENCES project_variant(id) ON DELETE SET NULL;
+
+-- Create an index on url_http_status (url_id, variant_id)
+CREATE INDEX idx_url_http_status_url_variant ON url_http_status (url_id, variant_id);
+
+-- Create trigger function to update 'updated_at' on row update for project_variant
+CREATE OR REPLACE FUNCTION update_project_variant_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+   NEW.updated_at = NOW();
+   RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create triggers for the project_variant table
+CREATE TRIGGER trigger_project_variant_updated_at
+BEFORE UPDATE ON project_variant
+FOR EACH ROW
+EXECUTE FUNCTION update_project_variant_updated_at();
@@ -0,0 +1,4 @@
+-- Drop the client certificate columns
+ALTER TABLE project_variant DROP CONSTRAINT IF EXISTS project_variant_client_subject_key;
+ALTER TABLE project_variant DROP COLUMN IF EXISTS client_subject;
+ALTER TABLE project DROP COLUMN IF EXISTS require_client_cert;
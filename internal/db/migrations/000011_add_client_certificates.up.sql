@@ -0,0 +1,6 @@
+-- Projects requiring mTLS only answer mock requests made with a verified client certificate
+ALTER TABLE project ADD COLUMN require_client_cert BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- The variant served to the clients whose certificate has the subject, unless the request selects one
+ALTER TABLE project_variant ADD COLUMN client_subject VARCHAR(255) NULL;
+ALTER TABLE project_variant ADD CONSTRAINT project_variant_client_subject_key UNIQUE (project_id, client_subject);
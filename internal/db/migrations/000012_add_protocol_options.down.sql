@@ -0,0 +1,5 @@
+-- Drop the protocol option columns
+ALTER TABLE url_http_status DROP COLUMN IF EXISTS early_hints;
+ALTER TABLE url_http_status DROP COLUMN IF EXISTS trailers;
+ALTER TABLE project DROP COLUMN IF EXISTS server_push;
+ALTER TABLE project DROP COLUMN IF EXISTS protocols;
@@ -0,0 +1,11 @@
+-- The protocols the mocks of a project answer over (http1, h2, h2c), every protocol when NULL
+ALTER TABLE project ADD COLUMN protocols JSONB NULL;
+
+-- Push the resources preloaded by the early hints of a response over HTTP/2
+ALTER TABLE project ADD COLUMN server_push BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Trailers sent after the body of a response, by name
+ALTER TABLE url_http_status ADD COLUMN trailers JSONB NULL;
+
+-- Link header values sent in a 103 Early Hints response before the response itself
+ALTER TABLE url_http_status ADD COLUMN early_hints JSONB NULL;
@@ -0,0 +1,12 @@
+-- Drop the email change tokens and the address they confirm
+DELETE FROM account_token WHERE purpose = 'email_change';
+ALTER TABLE account_token DROP COLUMN IF EXISTS email;
+
+-- Recreate the ENUM type without the email change purpose, values can't be dropped from an ENUM
+ALTER TYPE account_token_purpose_enum RENAME TO account_token_purpose_enum_old;
+CREATE TYPE account_token_purpose_enum AS ENUM ('email_verification', 'password_reset');
+ALTER TABLE account_token ALTER COLUMN purpose TYPE account_token_purpose_enum USING purpose::text::account_token_purpose_enum;
+DROP TYPE account_token_purpose_enum_old;
+
+-- Drop the pending email column
+ALTER TABLE account DROP COLUMN IF EXISTS pending_email;
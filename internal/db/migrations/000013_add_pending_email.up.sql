@@ -0,0 +1,6 @@
+-- A changed email waits in pending_email until the new address is verified
+ALTER TABLE account ADD COLUMN pending_email VARCHAR(255) NULL;
+
+-- Email change tokens confirm the address they were sent to
+ALTER TYPE account_token_purpose_enum ADD VALUE IF NOT EXISTS 'email_change';
+ALTER TABLE account_token ADD COLUMN email VARCHAR(255) NULL;
@@ -0,0 +1,3 @@
+-- Disabled accounts go back to being inactive
+UPDATE account SET is_active = FALSE WHERE disabled_at IS NOT NULL;
+ALTER TABLE account DROP COLUMN IF EXISTS disabled_at;
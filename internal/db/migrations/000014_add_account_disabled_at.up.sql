@@ -0,0 +1,5 @@
+-- Admins disable accounts with disabled_at, apart from is_active, which verifying the email sets
+ALTER TABLE account ADD COLUMN disabled_at TIMESTAMP NULL;
+
+-- Verified accounts that are inactive were deactivated by an admin
+UPDATE account SET disabled_at = CURRENT_TIMESTAMP WHERE is_active = FALSE AND email_verified_at IS NOT NULL;
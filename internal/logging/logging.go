@@ -0,0 +1,77 @@
+// Package logging configures the structured JSON logs of the server and carries the request ID
+// through the context, so every entry logged while serving a request can be traced back to it.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/adolfooes/api_faker/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Setup makes a JSON (or text, with LOG_FORMAT=text) logger at LOG_LEVEL the default logger.
+// The standard log package writes through it too, so older log calls are structured as well.
+func Setup() {
+	options := &slog.HandlerOptions{Level: parseLevel(config.GetLogLevel())}
+
+	var handler slog.Handler
+	if config.GetLogFormat() == "text" {
+		handler = slog.NewTextHandler(os.Stderr, options)
+	} else {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	}
+
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+// parseLevel returns the level named debug, info, warn or error, info when it is unknown
+func parseLevel(name string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(name))); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the ID of the request being served
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the ID of the request being served, or an empty string outside of a request
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// contextHandler adds the request ID and the trace of the context to the entries logged with one,
+// e.g. with slog.ErrorContext, so they can be found from the trace of the request and back
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
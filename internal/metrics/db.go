@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/adolfooes/api_faker/internal/db"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// journals are the tables that grow with every change: the audit log and the revision history
+var journals = []string{"audit_log", "revision"}
+
+var (
+	journalRowsDesc = prometheus.NewDesc(
+		"api_faker_journal_rows",
+		"Estimated number of entries of a journal table, as of its last analyze.",
+		[]string{"journal"}, nil,
+	)
+	journalBytesDesc = prometheus.NewDesc(
+		"api_faker_journal_bytes",
+		"Size of a journal table on disk, including its indexes and TOAST data.",
+		[]string{"journal"}, nil,
+	)
+)
+
+// RegisterDB adds the connection pool statistics of database and the size of the journals to the metrics
+func RegisterDB(database *sql.DB) {
+	Registry.MustRegister(
+		collectors.NewDBStatsCollector(database, "api_faker"),
+		journalCollector{database: database},
+	)
+}
+
+// journalCollector reads the size of the journals from the Postgres catalog when the metrics are scraped
+type journalCollector struct {
+	database *sql.DB
+}
+
+func (c journalCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- journalRowsDesc
+	ch <- journalBytesDesc
+}
+
+func (c journalCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := db.WithQueryTimeout(context.Background())
+	defer cancel()
+
+	// The row count is the planner's estimate, counting the rows of a large journal would be too slow for a scrape
+	rows, err := c.database.QueryContext(ctx,
+		`SELECT c.relname, GREATEST(c.reltuples, 0)::bigint, pg_total_relation_size(c.oid)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema() AND c.relkind = 'r' AND c.relname = ANY($1)`,
+		pq.Array(journals),
+	)
+	if err != nil {
+		slog.Error("Failed to collect the journal sizes", "error", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var journal string
+		var estimatedRows, size int64
+		if err := rows.Scan(&journal, &estimatedRows, &size); err != nil {
+			slog.Error("Failed to collect the journal sizes", "error", err)
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(journalRowsDesc, prometheus.GaugeValue, float64(estimatedRows), journal)
+		ch <- prometheus.MustNewConstMetric(journalBytesDesc, prometheus.GaugeValue, float64(size), journal)
+	}
+}
@@ -0,0 +1,148 @@
+// Package metrics collects the Prometheus metrics of the faker itself: the requests it serves,
+// the mocked responses, the route cache, the database queries and pool, and the size of its journals.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adolfooes/api_faker/internal/db"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric of the faker, along with the Go runtime and process metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_faker_http_requests_total",
+		Help: "HTTP requests served, by route template, method and returned status.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "api_faker_http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by route template, method and returned status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	mockRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_faker_mock_requests_total",
+		Help: "Mock requests served, by project, matched URL config and returned status.",
+	}, []string{"project", "url_config", "status"})
+
+	mockRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "api_faker_mock_request_duration_seconds",
+		Help:    "Time taken to serve mock requests, by project, matched URL config and returned status.",
+		Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"project", "url_config", "status"})
+
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_faker_mock_cache_lookups_total",
+		Help: "Lookups of compiled route tables, by result (hit or miss).",
+	}, []string{"result"})
+
+	dbQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_faker_db_queries_total",
+		Help: "Database operations run by the crud package, by operation, table and outcome.",
+	}, []string{"operation", "table", "outcome"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "api_faker_db_query_duration_seconds",
+		Help:    "Time taken by the database operations of the crud package, by operation and table.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "table"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpRequestDuration,
+		mockRequests, mockRequestDuration,
+		cacheLookups,
+		dbQueries, dbQueryDuration,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// statusLabels holds the label of every HTTP status, so observing a request doesn't format one
+var statusLabels = func() [600]string {
+	var labels [600]string
+	for status := range labels {
+		labels[status] = strconv.Itoa(status)
+	}
+	return labels
+}()
+
+// StatusLabel returns the label of an HTTP status
+func StatusLabel(status int) string {
+	if status < 0 || status >= len(statusLabels) {
+		return strconv.Itoa(status)
+	}
+	return statusLabels[status]
+}
+
+// MethodLabel returns the label of an HTTP method. Clients can send any token as method, so the
+// methods that aren't standard share the label other instead of creating a series each.
+func MethodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// ObserveHTTPRequest records a request served by a route, identified by its template (e.g. /api/project/{id})
+func ObserveHTTPRequest(route string, method string, status int, duration time.Duration) {
+	statusLabel, methodLabel := StatusLabel(status), MethodLabel(method)
+	httpRequests.WithLabelValues(route, methodLabel, statusLabel).Inc()
+	httpRequestDuration.WithLabelValues(route, methodLabel, statusLabel).Observe(duration.Seconds())
+}
+
+// ObserveMockRequest records a mock request. The project and URL config are empty when the request
+// didn't reach an existing project of the caller, or a configured URL.
+func ObserveMockRequest(project string, urlConfig string, status int, duration time.Duration) {
+	statusLabel := StatusLabel(status)
+	mockRequests.WithLabelValues(project, urlConfig, statusLabel).Inc()
+	mockRequestDuration.WithLabelValues(project, urlConfig, statusLabel).Observe(duration.Seconds())
+}
+
+// ObserveCacheLookup records whether a route table was found in the cache
+func ObserveCacheLookup(hit bool) {
+	if hit {
+		cacheLookups.WithLabelValues("hit").Inc()
+		return
+	}
+	cacheLookups.WithLabelValues("miss").Inc()
+}
+
+// ObserveQuery records a database operation started at start. It is deferred with a pointer to the
+// error the operation returns, e.g. defer metrics.ObserveQuery("read", table, time.Now(), &err).
+func ObserveQuery(operation string, table string, start time.Time, err *error) {
+	dbQueries.WithLabelValues(operation, table, queryOutcome(*err)).Inc()
+	dbQueryDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+}
+
+// queryOutcome classifies the error of a database operation
+func queryOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case db.IsTimeout(err):
+		return "timeout"
+	case db.IsCanceled(err):
+		return "canceled"
+	case db.IsUnavailable(err):
+		return "unavailable"
+	default:
+		return "error"
+	}
+}
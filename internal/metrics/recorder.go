@@ -0,0 +1,50 @@
+package metrics
+
+import "net/http"
+
+// ResponseRecorder wraps a response writer to remember the status it was sent with
+type ResponseRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// NewResponseRecorder returns a recorder writing to w
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	return &ResponseRecorder{ResponseWriter: w}
+}
+
+// IsInformational reports whether status is a 1xx status sent before the final one. 101 Switching
+// Protocols is final, the connection is handed over after it.
+func IsInformational(status int) bool {
+	return status >= 100 && status < 200 && status != http.StatusSwitchingProtocols
+}
+
+// WriteHeader records the status and sends it
+func (r *ResponseRecorder) WriteHeader(status int) {
+	// Informational statuses, like 103 Early Hints, come before the status of the response
+	if r.status == 0 && !IsInformational(status) {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write sends the body, with a 200 status when none was sent before
+func (r *ResponseRecorder) Write(body []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(body)
+}
+
+// Status returns the status sent, 200 when the handler wrote nothing
+func (r *ResponseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Unwrap returns the wrapped writer, so http.ResponseController reaches its flush and deadline methods
+func (r *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
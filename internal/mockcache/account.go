@@ -0,0 +1,90 @@
+package mockcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/adolfooes/api_faker/internal/repository"
+)
+
+// accountTTL bounds how long the status of an account is trusted without reading it again, in case
+// an invalidation is missed, e.g. from a replica without MOCK_CACHE_NOTIFY
+const accountTTL = 10 * time.Second
+
+// accountStatus is the cached status of an account
+type accountStatus struct {
+	canSignIn bool
+	expires   time.Time
+}
+
+// AccountCache holds whether the accounts that recently authenticated can sign in, so authenticating
+// a request, mock requests included, doesn't read the account every time
+type AccountCache struct {
+	mu       sync.Mutex
+	accounts map[int64]accountStatus
+
+	// generations and epoch keep a status read while its account was being changed from being stored, like in Cache
+	generations map[int64]uint64
+	epoch       uint64
+}
+
+// NewAccountCache returns an empty account cache
+func NewAccountCache() *AccountCache {
+	return &AccountCache{
+		accounts:    map[int64]accountStatus{},
+		generations: map[int64]uint64{},
+	}
+}
+
+var defaultAccounts = NewAccountCache()
+
+// Accounts returns the account cache used to authenticate requests
+func Accounts() *AccountCache {
+	return defaultAccounts
+}
+
+// CanSignIn reports whether the account exists, is verified and isn't disabled, reading it when its
+// status isn't cached or is older than accountTTL
+func (c *AccountCache) CanSignIn(ctx context.Context, accountID int64) (bool, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	status, ok := c.accounts[accountID]
+	generation, epoch := c.generations[accountID], c.epoch
+	c.mu.Unlock()
+	if ok && now.Before(status.expires) {
+		return status.canSignIn, nil
+	}
+
+	account, err := repository.Default().GetAccount(ctx, accountID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return false, err
+	}
+	status = accountStatus{canSignIn: err == nil && account.CanSignIn(), expires: now.Add(accountTTL)}
+
+	c.mu.Lock()
+	if c.generations[accountID] == generation && c.epoch == epoch {
+		c.accounts[accountID] = status
+	}
+	c.mu.Unlock()
+
+	return status.canSignIn, nil
+}
+
+// Invalidate drops the status of the account, so the next request reads it again
+func (c *AccountCache) Invalidate(accountID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.accounts, accountID)
+	c.generations[accountID]++
+}
+
+// InvalidateAll drops the status of every account
+func (c *AccountCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accounts = map[int64]accountStatus{}
+	c.epoch++
+}
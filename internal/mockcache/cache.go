@@ -0,0 +1,102 @@
+package mockcache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/adolfooes/api_faker/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Cache holds the compiled tables of the projects that were mocked since they last changed
+type Cache struct {
+	mu       sync.Mutex
+	tables   map[int64]*Table
+	disabled bool // Load the table on every call instead of keeping it
+
+	// generations count the invalidations of each project, and epoch those of the whole cache, so a
+	// table loaded while its project was being changed isn't stored over the change
+	generations map[int64]uint64
+	epoch       uint64
+}
+
+// New returns an empty cache
+func New() *Cache {
+	return &Cache{
+		tables:      map[int64]*Table{},
+		generations: map[int64]uint64{},
+	}
+}
+
+var defaultCache = New()
+
+// Default returns the cache used by the mock handler
+func Default() *Cache {
+	return defaultCache
+}
+
+// Get returns the table of the project, loading and compiling it when it isn't cached.
+// When the cache is disabled the table is loaded on every call.
+func (c *Cache) Get(ctx context.Context, projectID int64) (*Table, error) {
+	c.mu.Lock()
+	disabled := c.disabled
+	table, ok := c.tables[projectID]
+	generation, epoch := c.generations[projectID], c.epoch
+	c.mu.Unlock()
+	if disabled {
+		return Load(ctx, projectID)
+	}
+	metrics.ObserveCacheLookup(ok)
+	if span := trace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(attribute.Bool("faker.cache_hit", ok))
+	}
+	if ok {
+		return table, nil
+	}
+
+	table, err := Load(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.generations[projectID] == generation && c.epoch == epoch {
+		c.tables[projectID] = table
+	}
+	c.mu.Unlock()
+
+	return table, nil
+}
+
+// Put stores a table compiled by the caller, until its project changes
+func (c *Cache) Put(table *Table) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tables[table.ProjectID] = table
+}
+
+// SetEnabled turns the cache on or off. A disabled cache drops its tables and loads them on every call.
+func (c *Cache) SetEnabled(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disabled = !enabled
+	c.tables = map[int64]*Table{}
+	c.epoch++
+}
+
+// Invalidate drops the table of the project, so the next request loads its current configuration
+func (c *Cache) Invalidate(projectID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tables, projectID)
+	c.generations[projectID]++
+}
+
+// InvalidateAll drops the tables of every project
+func (c *Cache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tables = map[int64]*Table{}
+	c.epoch++
+}
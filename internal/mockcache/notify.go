@@ -0,0 +1,109 @@
+package mockcache
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/db"
+	"github.com/adolfooes/api_faker/pkg/utils/crud"
+	"github.com/lib/pq"
+)
+
+// notifyChannel is the Postgres channel the replicas announce the changed projects and accounts on.
+// Projects are announced by id, accounts by id with accountPrefix.
+const (
+	notifyChannel = "api_faker_mock_routes"
+	accountPrefix = "account:"
+)
+
+// Start configures the default cache with MOCK_CACHE and invalidates its tables on every audited write
+// of a project. With MOCK_CACHE_NOTIFY the changes are also announced to, and received from, the other replicas.
+func Start(connStr string) error {
+	defaultCache.SetEnabled(config.GetMockCacheEnabled())
+	notify := config.GetMockCacheNotify()
+
+	crud.OnProjectChange(func(projectID int64) {
+		defaultCache.Invalidate(projectID)
+		if notify {
+			announce(strconv.FormatInt(projectID, 10))
+		}
+	})
+
+	if !notify {
+		return nil
+	}
+	return listen(connStr, defaultCache, defaultAccounts)
+}
+
+// AccountChanged drops the cached status of an account that was disabled, enabled or deleted. With
+// MOCK_CACHE_NOTIFY the other replicas drop it too, otherwise they read it again within accountTTL.
+func AccountChanged(accountID int64) {
+	defaultAccounts.Invalidate(accountID)
+	if config.GetMockCacheNotify() {
+		announce(accountPrefix + strconv.FormatInt(accountID, 10))
+	}
+}
+
+// announce notifies the other replicas that the project or account in payload changed
+func announce(payload string) {
+	ctx, cancel := db.WithQueryTimeout(context.Background())
+	defer cancel()
+
+	if _, err := db.GetDB().ExecContext(ctx, "SELECT pg_notify($1, $2)", notifyChannel, payload); err != nil {
+		slog.Error("Failed to announce a change", "change", payload, "error", err)
+	}
+}
+
+// listen invalidates the tables of the projects and the status of the accounts announced by the replicas,
+// including this one. Changes may be missed while the connection is down, so both caches are dropped when it comes back.
+func listen(connStr string, c *Cache, accounts *AccountCache) error {
+	listener := pq.NewListener(connStr, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Error("Mock cache listener failed", "error", err)
+		}
+	})
+	if err := listener.Listen(notifyChannel); err != nil {
+		listener.Close()
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case notification := <-listener.Notify:
+				// A nil notification is sent after the connection was re-established
+				if notification == nil {
+					c.InvalidateAll()
+					accounts.InvalidateAll()
+					continue
+				}
+
+				if id, ok := strings.CutPrefix(notification.Extra, accountPrefix); ok {
+					accountID, err := strconv.ParseInt(id, 10, 64)
+					if err != nil {
+						slog.Warn("Mock cache listener received an invalid account", "account", notification.Extra)
+						continue
+					}
+					accounts.Invalidate(accountID)
+					continue
+				}
+
+				projectID, err := strconv.ParseInt(notification.Extra, 10, 64)
+				if err != nil {
+					slog.Warn("Mock cache listener received an invalid project", "project", notification.Extra)
+					continue
+				}
+				c.Invalidate(projectID)
+			case <-time.After(90 * time.Second):
+				// Check the connection, which may have gone down without an error while idle
+				go listener.Ping()
+			}
+		}
+	}()
+
+	return nil
+}
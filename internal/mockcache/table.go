@@ -0,0 +1,310 @@
+// Package mockcache keeps the mocked URLs of each project compiled into a routing table in memory,
+// so the mock handler answers without querying the database. A table is dropped when an audited
+// write changes its project, and optionally when another replica announces a change through Postgres NOTIFY.
+package mockcache
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adolfooes/api_faker/internal/db"
+	"github.com/adolfooes/api_faker/internal/repository"
+)
+
+// Table is the compiled routing table of a project
+type Table struct {
+	ProjectID       int64
+	ProjectLabel    string // ProjectID formatted for metric labels
+	OwnerID         int64
+	Type            string
+	ActiveVariantID *int64
+	// RequireClientCert makes the project answer only requests made with a verified client certificate
+	RequireClientCert bool
+	// ServerPush pushes the resources preloaded by the early hints of a response over HTTP/2
+	ServerPush bool
+
+	protocols         map[string]bool // Nil when every protocol is allowed
+	routes            map[routeKey]*Route
+	variants          map[int64]*Variant
+	variantsByName    map[string]*Variant
+	variantsBySubject map[string]*Variant
+}
+
+// routeKey identifies a route by its method and path
+type routeKey struct {
+	method string
+	path   string
+}
+
+// Route is a mocked URL of the project with the responses it picks from
+type Route struct {
+	URLID    int64
+	URLLabel string // URLID formatted for metric labels
+	Method   string
+	Path     string
+
+	defaults  Responses
+	byVariant map[int64]Responses
+}
+
+// Response is an HTTP status a route can respond with, and its pre-serialized body
+type Response struct {
+	StatusID   int64
+	HTTPStatus int
+	Body       []byte
+	HasBody    bool // False when the status has no response model
+
+	Trailers   []Trailer // Sent after the body, in name order
+	EarlyHints []string  // Link header values sent in a 103 Early Hints response first
+	PushPaths  []string  // Same-origin targets of the early hints, which can be pushed over HTTP/2
+}
+
+// Trailer is a trailer of a response, with its canonical name
+type Trailer struct {
+	Name  string
+	Value string
+}
+
+// Responses are the statuses a route picks from, with the cumulative percentages used to pick one
+type Responses struct {
+	responses  []Response
+	cumulative []int
+}
+
+// Variant is a named set of responses of the project, with its pre-serialized fallback response
+type Variant struct {
+	ID                 int64
+	Name               string
+	FallbackHTTPStatus *int64
+	FallbackBody       []byte
+}
+
+// AllowsProtocol reports whether the mocks of the project answer requests made over the protocol
+func (t *Table) AllowsProtocol(protocol string) bool {
+	return t.protocols == nil || t.protocols[protocol]
+}
+
+// VariantByClientSubject returns the variant served to the clients whose certificate has the subject,
+// matched on the whole distinguished name (e.g. CN=billing,O=Acme) then on the common name. It returns
+// nil when no variant is set for the subject.
+func (t *Table) VariantByClientSubject(subject pkix.Name) *Variant {
+	if len(t.variantsBySubject) == 0 {
+		return nil
+	}
+	if variant := t.variantsBySubject[subject.String()]; variant != nil {
+		return variant
+	}
+	return t.variantsBySubject[subject.CommonName]
+}
+
+// Route returns the route of the method and path, or nil when the URL isn't configured
+func (t *Table) Route(method string, path string) *Route {
+	return t.routes[routeKey{method: method, path: path}]
+}
+
+// Variant returns the variant with the id, or nil when the project has none
+func (t *Table) Variant(id int64) *Variant {
+	return t.variants[id]
+}
+
+// VariantByName returns the variant with the name, or nil when the project has none
+func (t *Table) VariantByName(name string) *Variant {
+	return t.variantsByName[name]
+}
+
+// Responses returns the statuses the route responds with in the variant, or its default statuses when
+// variant is nil. They are empty when the route has no statuses of its own in the variant.
+func (r *Route) Responses(variant *Variant) Responses {
+	if variant == nil {
+		return r.defaults
+	}
+	return r.byVariant[variant.ID]
+}
+
+// Empty reports whether there are no statuses to pick from
+func (r Responses) Empty() bool {
+	return len(r.responses) == 0
+}
+
+// Pick returns the status whose percentage range holds n, a number between 0 and 99.
+// When the percentages add up to less than 100 and n is past them, the first status is returned.
+func (r Responses) Pick(n int) Response {
+	for i, upTo := range r.cumulative {
+		if n < upTo {
+			return r.responses[i]
+		}
+	}
+	return r.responses[0]
+}
+
+// add appends a status to pick from
+func (r *Responses) add(response Response, percentage int) {
+	total := 0
+	if len(r.cumulative) > 0 {
+		total = r.cumulative[len(r.cumulative)-1]
+	}
+	r.responses = append(r.responses, response)
+	r.cumulative = append(r.cumulative, total+percentage)
+}
+
+// Load reads the project and its variants, URL configs, statuses and models in a single snapshot,
+// and compiles them into a table. It returns repository.ErrNotFound when the project doesn't exist.
+func Load(ctx context.Context, projectID int64) (*Table, error) {
+	tx, err := db.GetDB().BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	q := repository.New(tx)
+
+	project, err := q.GetProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	variants, err := q.ListProjectVariants(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	urlConfigs, err := q.ListURLConfigsByProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := q.ListURLHTTPStatusesByProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	models, err := q.ListFirstResponseModelsByProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	return Compile(project, variants, urlConfigs, statuses, models), nil
+}
+
+// Compile builds the table of a project from its records. The statuses must be in creation order.
+func Compile(
+	project repository.Project,
+	variants []repository.ProjectVariant,
+	urlConfigs []repository.URLConfig,
+	statuses []repository.URLHTTPStatus,
+	models []repository.ResponseModel,
+) *Table {
+	table := &Table{
+		ProjectID:         project.ID,
+		ProjectLabel:      strconv.FormatInt(project.ID, 10),
+		OwnerID:           project.OwnerID,
+		Type:              project.Type,
+		ActiveVariantID:   project.ActiveVariantID,
+		RequireClientCert: project.RequireClientCert,
+		ServerPush:        project.ServerPush,
+		routes:            make(map[routeKey]*Route, len(urlConfigs)),
+		variants:          make(map[int64]*Variant, len(variants)),
+		variantsByName:    make(map[string]*Variant, len(variants)),
+		variantsBySubject: map[string]*Variant{},
+	}
+
+	if len(project.Protocols) > 0 {
+		table.protocols = make(map[string]bool, len(project.Protocols))
+		for _, protocol := range project.Protocols {
+			table.protocols[protocol] = true
+		}
+	}
+
+	for _, record := range variants {
+		variant := &Variant{
+			ID:                 record.ID,
+			Name:               record.Name,
+			FallbackHTTPStatus: record.FallbackHTTPStatus,
+			FallbackBody:       record.FallbackModel,
+		}
+		if variant.FallbackBody == nil {
+			variant.FallbackBody = []byte("null")
+		}
+		table.variants[variant.ID] = variant
+		table.variantsByName[variant.Name] = variant
+		if record.ClientSubject != "" {
+			table.variantsBySubject[record.ClientSubject] = variant
+		}
+	}
+
+	routesByURL := make(map[int64]*Route, len(urlConfigs))
+	for _, urlConfig := range urlConfigs {
+		route := &Route{
+			URLID:     urlConfig.ID,
+			URLLabel:  strconv.FormatInt(urlConfig.ID, 10),
+			Method:    urlConfig.Method,
+			Path:      urlConfig.Path,
+			byVariant: map[int64]Responses{},
+		}
+		table.routes[routeKey{method: route.Method, path: route.Path}] = route
+		routesByURL[route.URLID] = route
+	}
+
+	bodies := make(map[int64][]byte, len(models))
+	for _, model := range models {
+		bodies[model.URLHTTPStatusID] = model.Model
+	}
+
+	// Statuses come in creation order, which is the order the percentage ranges are laid out in
+	for _, status := range statuses {
+		route, ok := routesByURL[status.URLID]
+		if !ok {
+			continue
+		}
+
+		body, hasBody := bodies[status.ID]
+		response := Response{StatusID: status.ID, HTTPStatus: status.HTTPStatus, Body: body, HasBody: hasBody}
+		response.Trailers = compileTrailers(status.Trailers)
+		response.EarlyHints = status.EarlyHints
+		response.PushPaths = pushPaths(status.EarlyHints)
+
+		if status.VariantID == nil {
+			route.defaults.add(response, status.Percentage)
+			continue
+		}
+		responses := route.byVariant[*status.VariantID]
+		responses.add(response, status.Percentage)
+		route.byVariant[*status.VariantID] = responses
+	}
+
+	return table
+}
+
+// compileTrailers returns the trailers with canonical names, sorted so responses are reproducible
+func compileTrailers(trailers map[string]string) []Trailer {
+	if len(trailers) == 0 {
+		return nil
+	}
+
+	compiled := make([]Trailer, 0, len(trailers))
+	for name, value := range trailers {
+		compiled = append(compiled, Trailer{Name: http.CanonicalHeaderKey(name), Value: value})
+	}
+	sort.Slice(compiled, func(i, j int) bool { return compiled[i].Name < compiled[j].Name })
+	return compiled
+}
+
+// pushPaths returns the same-origin targets of Link header values, e.g. /app.css for
+// "</app.css>; rel=preload; as=style". Other origins can't be pushed.
+func pushPaths(links []string) []string {
+	var paths []string
+	for _, link := range links {
+		start := strings.IndexByte(link, '<')
+		end := strings.IndexByte(link, '>')
+		if start != 0 || end < 0 {
+			continue
+		}
+		target := link[start+1 : end]
+		if strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//") {
+			paths = append(paths, target)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,278 @@
+// Package pki is the certificate authority of the faker. It issues the certificate the server is
+// served with in auto TLS mode, and client certificates for the projects, which clients use for mTLS.
+// The CA is generated on first use and kept in a directory, so certificates survive restarts and
+// replicas sharing the directory trust each other's certificates.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files of the CA in its directory
+const (
+	caCertFile = "ca.crt"
+	caKeyFile  = "ca.key"
+)
+
+// caValidity is how long a generated CA is valid
+const caValidity = 10 * 365 * 24 * time.Hour
+
+// serverCertValidity is how long the certificate the server is served with is valid. It is issued
+// again at every start.
+const serverCertValidity = 90 * 24 * time.Hour
+
+// projectURIPrefix prefixes the URI SAN identifying the project a client certificate was issued for
+const projectURIPrefix = "api-faker:project:"
+
+// CA issues the certificates of the faker
+type CA struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	certPEM []byte
+}
+
+// ClientCertificate is a client certificate issued for a project, PEM encoded
+type ClientCertificate struct {
+	Certificate   string    `json:"certificate"`
+	PrivateKey    string    `json:"private_key"`
+	CACertificate string    `json:"ca_certificate"` // To trust the server in auto TLS mode
+	Subject       string    `json:"subject"`
+	SerialNumber  string    `json:"serial_number"`
+	NotAfter      time.Time `json:"not_after"`
+}
+
+// LoadOrCreate returns the CA kept in dir, generating it when the directory has none
+func LoadOrCreate(dir string) (*CA, error) {
+	certPEM, err := os.ReadFile(filepath.Join(dir, caCertFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return create(dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading the CA certificate: %w", err)
+	}
+
+	keyPEM, err := os.ReadFile(filepath.Join(dir, caKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the CA key: %w", err)
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the CA: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the CA certificate: %w", err)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("the CA key can't sign certificates")
+	}
+
+	return &CA{cert: cert, key: key, certPEM: certPEM}, nil
+}
+
+// create generates a self-signed CA and writes it to dir. The key is only readable by the server.
+func create(dir string) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating the CA key: %w", err)
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "api_faker CA", Organization: []string{"api_faker"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating the CA directory: %w", err)
+	}
+	// The key is written first, so a CA certificate on disk always has its key next to it
+	if err := os.WriteFile(filepath.Join(dir, caKeyFile), keyPEM, 0o600); err != nil {
+		return nil, fmt.Errorf("error writing the CA key: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, caCertFile), certPEM, 0o644); err != nil {
+		return nil, fmt.Errorf("error writing the CA certificate: %w", err)
+	}
+
+	return &CA{cert: cert, key: key, certPEM: certPEM}, nil
+}
+
+// CertificatePEM returns the certificate of the CA, for clients to trust the server and for the server
+// to verify client certificates
+func (ca *CA) CertificatePEM() []byte {
+	return ca.certPEM
+}
+
+// Certificate returns the certificate of the CA
+func (ca *CA) Certificate() *x509.Certificate {
+	return ca.cert
+}
+
+// ServerCertificate issues the certificate the server is served with, for the host names and IPs
+func (ca *CA) ServerCertificate(hosts []string) (tls.Certificate, error) {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: hosts[0], Organization: []string{"api_faker"}},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, key, err := ca.issue(template, serverCertValidity)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der, ca.cert.Raw}, PrivateKey: key}, nil
+}
+
+// IssueClientCertificate issues a client certificate with the subject for the project. The project is
+// recorded in the certificate, so it isn't accepted by the other projects.
+func (ca *CA) IssueClientCertificate(projectID int64, subject pkix.Name, validity time.Duration) (ClientCertificate, error) {
+	template := &x509.Certificate{
+		Subject:     subject,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		URIs:        []*url.URL{{Scheme: "urn", Opaque: projectURIPrefix + strconv.FormatInt(projectID, 10)}},
+	}
+
+	der, key, err := ca.issue(template, validity)
+	if err != nil {
+		return ClientCertificate{}, err
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return ClientCertificate{}, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return ClientCertificate{}, err
+	}
+
+	return ClientCertificate{
+		Certificate:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		PrivateKey:    string(keyPEM),
+		CACertificate: string(ca.certPEM),
+		Subject:       cert.Subject.String(),
+		SerialNumber:  cert.SerialNumber.Text(16),
+		NotAfter:      cert.NotAfter,
+	}, nil
+}
+
+// issue signs the template with a new key, valid from now for validity
+func (ca *CA) issue(template *x509.Certificate, validity time.Duration) ([]byte, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating the certificate key: %w", err)
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	template.SerialNumber = serial
+	// Backdated a little, so clocks running slightly behind accept the certificate at once
+	template.NotBefore = time.Now().Add(-5 * time.Minute)
+	template.NotAfter = time.Now().Add(validity)
+	if template.NotAfter.After(ca.cert.NotAfter) {
+		template.NotAfter = ca.cert.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error signing the certificate: %w", err)
+	}
+	return der, key, nil
+}
+
+// ProjectID returns the project a client certificate was issued for by the CA, false for the
+// certificates of other CAs
+func ProjectID(cert *x509.Certificate) (int64, bool) {
+	for _, uri := range cert.URIs {
+		if uri.Scheme != "urn" || !strings.HasPrefix(uri.Opaque, projectURIPrefix) {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(uri.Opaque, projectURIPrefix), 10, 64)
+		if err == nil {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// serialNumber returns a random 128-bit serial number
+func serialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("error generating a serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// encodeKey returns the key PEM encoded as PKCS #8
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding the key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+var defaultCA *CA
+
+// SetDefault makes ca the CA issuing the project certificates
+func SetDefault(ca *CA) {
+	defaultCA = ca
+}
+
+// Default returns the CA issuing the project certificates, nil when the server doesn't run one
+func Default() *CA {
+	return defaultCA
+}
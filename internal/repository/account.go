@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Account is a user of the API. The password hash is never encoded in responses.
+type Account struct {
+	ID              int64      `json:"id"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"`
+	Role            string     `json:"role"`
+	IsActive        bool       `json:"is_active"`   // Set once the email is verified
+	DisabledAt      *time.Time `json:"disabled_at"` // Set while an admin disables the account
+	LastLogin       *time.Time `json:"last_login"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+const accountColumns = `id, email, password, role, COALESCE(is_active, FALSE), disabled_at, last_login, email_verified_at, created_at, updated_at`
+
+func scanAccount(row scanner) (Account, error) {
+	var account Account
+	var disabledAt, lastLogin, emailVerifiedAt, createdAt, updatedAt sql.NullTime
+	err := row.Scan(
+		&account.ID, &account.Email, &account.Password, &account.Role, &account.IsActive,
+		&disabledAt, &lastLogin, &emailVerifiedAt, &createdAt, &updatedAt,
+	)
+	account.DisabledAt = nullTime(disabledAt)
+	account.LastLogin = nullTime(lastLogin)
+	account.EmailVerifiedAt = nullTime(emailVerifiedAt)
+	account.CreatedAt = createdAt.Time
+	account.UpdatedAt = updatedAt.Time
+	return account, err
+}
+
+// CanSignIn reports whether the account is verified and not disabled by an admin
+func (a Account) CanSignIn() bool {
+	return a.IsActive && a.DisabledAt == nil
+}
+
+// GetAccount returns the account with the id
+func (q *Queries) GetAccount(ctx context.Context, id int64) (Account, error) {
+	return queryOne(ctx, q.db, scanAccount, "SELECT "+accountColumns+" FROM account WHERE id = $1", id)
+}
+
+// GetAccountByEmail returns the account with the email. Emails are stored lowercased.
+func (q *Queries) GetAccountByEmail(ctx context.Context, email string) (Account, error) {
+	return queryOne(ctx, q.db, scanAccount, "SELECT "+accountColumns+" FROM account WHERE email = $1", strings.ToLower(email))
+}
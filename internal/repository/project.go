@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Project is a project of an account, serving either mocked URLs or a fake OIDC provider
+type Project struct {
+	ID              int64  `json:"id"`
+	OwnerID         int64  `json:"owner_id"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	Type            string `json:"type"`
+	ActiveVariantID *int64 `json:"active_variant_id"`
+	// RequireClientCert makes the mocks answer only requests made with a verified client certificate
+	RequireClientCert bool `json:"require_client_cert"`
+	// Protocols the mocks answer over (http1, h2, h2c), every protocol when empty
+	Protocols  []string   `json:"protocols"`
+	ServerPush bool       `json:"server_push"` // Push the resources preloaded by early hints over HTTP/2
+	IsActive   bool       `json:"is_active"`
+	RemovedAt  *time.Time `json:"removed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+const projectColumns = `id, owner_id, name, COALESCE(description, ''), type, active_variant_id, require_client_cert, protocols, server_push,
+	COALESCE(is_active, FALSE), removed_at, created_at, updated_at`
+
+func scanProject(row scanner) (Project, error) {
+	var project Project
+	var activeVariantID sql.NullInt64
+	var protocols []byte
+	var removedAt, createdAt, updatedAt sql.NullTime
+	err := row.Scan(
+		&project.ID, &project.OwnerID, &project.Name, &project.Description, &project.Type, &activeVariantID, &project.RequireClientCert, &protocols, &project.ServerPush,
+		&project.IsActive, &removedAt, &createdAt, &updatedAt,
+	)
+	project.ActiveVariantID = nullInt64(activeVariantID)
+	if err == nil {
+		err = decodeJSON(protocols, &project.Protocols)
+	}
+	project.RemovedAt = nullTime(removedAt)
+	project.CreatedAt = createdAt.Time
+	project.UpdatedAt = updatedAt.Time
+	return project, err
+}
+
+// GetProject returns the project with the id
+func (q *Queries) GetProject(ctx context.Context, id int64) (Project, error) {
+	return queryOne(ctx, q.db, scanProject, "SELECT "+projectColumns+" FROM project WHERE id = $1", id)
+}
+
+// GetOwnedProject returns the project with the id if it is owned by the account
+func (q *Queries) GetOwnedProject(ctx context.Context, id int64, ownerID int64) (Project, error) {
+	return queryOne(ctx, q.db, scanProject, "SELECT "+projectColumns+" FROM project WHERE id = $1 AND owner_id = $2", id, ownerID)
+}
+
+// ListProjectsByOwner returns the projects owned by the account, in creation order
+func (q *Queries) ListProjectsByOwner(ctx context.Context, ownerID int64) ([]Project, error) {
+	return queryAll(ctx, q.db, scanProject, "SELECT "+projectColumns+" FROM project WHERE owner_id = $1 ORDER BY id", ownerID)
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// ProjectVariant is a named set of responses of a project. URLs without statuses in the variant
+// serve its fallback response, when it has one.
+type ProjectVariant struct {
+	ID                 int64           `json:"id"`
+	ProjectID          int64           `json:"project_id"`
+	Name               string          `json:"name"`
+	Description        string          `json:"description"`
+	FallbackHTTPStatus *int64          `json:"fallback_http_status"`
+	FallbackModel      json.RawMessage `json:"fallback_model"`
+	ClientSubject      string          `json:"client_subject"` // Served to the clients whose certificate has the subject
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+}
+
+const projectVariantColumns = `id, project_id, name, COALESCE(description, ''), fallback_http_status, fallback_model,
+	COALESCE(client_subject, ''), created_at, updated_at`
+
+func scanProjectVariant(row scanner) (ProjectVariant, error) {
+	var variant ProjectVariant
+	var fallbackHTTPStatus sql.NullInt64
+	var fallbackModel []byte
+	var createdAt, updatedAt sql.NullTime
+	err := row.Scan(
+		&variant.ID, &variant.ProjectID, &variant.Name, &variant.Description,
+		&fallbackHTTPStatus, &fallbackModel, &variant.ClientSubject, &createdAt, &updatedAt,
+	)
+	variant.FallbackHTTPStatus = nullInt64(fallbackHTTPStatus)
+	if fallbackModel != nil {
+		variant.FallbackModel = json.RawMessage(fallbackModel)
+	}
+	variant.CreatedAt = createdAt.Time
+	variant.UpdatedAt = updatedAt.Time
+	return variant, err
+}
+
+// ListProjectVariants returns the variants of the project, in creation order
+func (q *Queries) ListProjectVariants(ctx context.Context, projectID int64) ([]ProjectVariant, error) {
+	return queryAll(ctx, q.db, scanProjectVariant, "SELECT "+projectVariantColumns+" FROM project_variant WHERE project_id = $1 ORDER BY id", projectID)
+}
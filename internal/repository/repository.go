@@ -0,0 +1,112 @@
+// Package repository reads the main records of the API as typed structs. Unlike the generic crud
+// package it selects explicit columns and scans them into typed fields, so a malformed row is
+// reported as an error instead of making a handler panic on a type assertion.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adolfooes/api_faker/internal/db"
+)
+
+// ErrNotFound is returned when the requested record doesn't exist
+var ErrNotFound = errors.New("record not found")
+
+// DBTX runs queries with a context, both *sql.DB and *sql.Tx implement it
+type DBTX interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Queries runs the typed queries on a database or a transaction
+type Queries struct {
+	db DBTX
+}
+
+// New returns the queries running on db
+func New(db DBTX) *Queries {
+	return &Queries{db: db}
+}
+
+// Default returns the queries running on the application database
+func Default() *Queries {
+	return New(db.GetDB())
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryOne runs a query returning at most one row and scans it with scan
+func queryOne[T any](ctx context.Context, q DBTX, scan func(scanner) (T, error), query string, args ...interface{}) (T, error) {
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	record, err := scan(q.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return record, ErrNotFound
+	}
+	if err != nil {
+		return record, fmt.Errorf("error reading record: %w", err)
+	}
+	return record, nil
+}
+
+// queryAll runs a query and scans each of its rows with scan
+func queryAll[T any](ctx context.Context, q DBTX, scan func(scanner) (T, error), query string, args ...interface{}) ([]T, error) {
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing records: %w", err)
+	}
+	defer rows.Close()
+
+	records := []T{}
+	for rows.Next() {
+		record, err := scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading record: %w", err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over records: %w", err)
+	}
+	return records, nil
+}
+
+// nullInt64 returns a pointer to the value, or nil when it is NULL
+func nullInt64(value sql.NullInt64) *int64 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Int64
+}
+
+// nullTime returns a pointer to the value, or nil when it is NULL
+func nullTime(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Time
+}
+
+// decodeJSON decodes a JSONB column into v, leaving v empty when it is NULL
+func decodeJSON(data []byte, v interface{}) error {
+	if data == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error decoding JSON column: %w", err)
+	}
+	return nil
+}
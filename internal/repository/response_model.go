@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// ResponseModel is the JSON body an HTTP status of a URL config responds with
+type ResponseModel struct {
+	ID              int64           `json:"id"`
+	URLHTTPStatusID int64           `json:"url_http_status_id"`
+	Model           json.RawMessage `json:"model"`
+	Description     string          `json:"description"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+const responseModelColumns = `id, url_http_status_id, model, COALESCE(description, ''), created_at, updated_at`
+
+func scanResponseModel(row scanner) (ResponseModel, error) {
+	var model ResponseModel
+	var body []byte
+	var createdAt, updatedAt sql.NullTime
+	err := row.Scan(&model.ID, &model.URLHTTPStatusID, &body, &model.Description, &createdAt, &updatedAt)
+	model.Model = json.RawMessage(body)
+	model.CreatedAt = createdAt.Time
+	model.UpdatedAt = updatedAt.Time
+	return model, err
+}
+
+// GetResponseModel returns the response model with the id
+func (q *Queries) GetResponseModel(ctx context.Context, id int64) (ResponseModel, error) {
+	return queryOne(ctx, q.db, scanResponseModel, "SELECT "+responseModelColumns+" FROM response_model WHERE id = $1", id)
+}
+
+// FirstResponseModel returns the model an HTTP status responds with: its first one, when it has several
+func (q *Queries) FirstResponseModel(ctx context.Context, urlHTTPStatusID int64) (ResponseModel, error) {
+	return queryOne(ctx, q.db, scanResponseModel,
+		"SELECT "+responseModelColumns+" FROM response_model WHERE url_http_status_id = $1 ORDER BY id LIMIT 1",
+		urlHTTPStatusID,
+	)
+}
+
+// ListFirstResponseModelsByProject returns the model each HTTP status of the project responds with,
+// as FirstResponseModel does for one status
+func (q *Queries) ListFirstResponseModelsByProject(ctx context.Context, projectID int64) ([]ResponseModel, error) {
+	return queryAll(ctx, q.db, scanResponseModel,
+		`SELECT DISTINCT ON (m.url_http_status_id)
+			m.id, m.url_http_status_id, m.model, COALESCE(m.description, ''), m.created_at, m.updated_at
+		FROM response_model m
+		JOIN url_http_status s ON s.id = m.url_http_status_id
+		JOIN url_config uc ON uc.id = s.url_id
+		WHERE uc.project_id = $1
+		ORDER BY m.url_http_status_id, m.id`,
+		projectID,
+	)
+}
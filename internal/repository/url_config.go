@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// URLConfig is a mocked URL of a project, identified by its path and method
+type URLConfig struct {
+	ID          int64     `json:"id"`
+	ProjectID   int64     `json:"project_id"`
+	Path        string    `json:"path"`
+	Method      string    `json:"method"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+const urlConfigColumns = `id, project_id, path, method, COALESCE(description, ''), created_at, updated_at`
+
+func scanURLConfig(row scanner) (URLConfig, error) {
+	var urlConfig URLConfig
+	var createdAt, updatedAt sql.NullTime
+	err := row.Scan(
+		&urlConfig.ID, &urlConfig.ProjectID, &urlConfig.Path, &urlConfig.Method, &urlConfig.Description,
+		&createdAt, &updatedAt,
+	)
+	urlConfig.CreatedAt = createdAt.Time
+	urlConfig.UpdatedAt = updatedAt.Time
+	return urlConfig, err
+}
+
+// GetURLConfig returns the URL config with the id
+func (q *Queries) GetURLConfig(ctx context.Context, id int64) (URLConfig, error) {
+	return queryOne(ctx, q.db, scanURLConfig, "SELECT "+urlConfigColumns+" FROM url_config WHERE id = $1", id)
+}
+
+// FindURLConfig returns the URL config of the project with the path and method
+func (q *Queries) FindURLConfig(ctx context.Context, projectID int64, path string, method string) (URLConfig, error) {
+	return queryOne(ctx, q.db, scanURLConfig,
+		"SELECT "+urlConfigColumns+" FROM url_config WHERE project_id = $1 AND path = $2 AND method = $3::http_method_enum",
+		projectID, path, method,
+	)
+}
+
+// ListURLConfigsByProject returns the URL configs of the project, in creation order
+func (q *Queries) ListURLConfigsByProject(ctx context.Context, projectID int64) ([]URLConfig, error) {
+	return queryAll(ctx, q.db, scanURLConfig, "SELECT "+urlConfigColumns+" FROM url_config WHERE project_id = $1 ORDER BY id", projectID)
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// URLHTTPStatus is one of the HTTP statuses a URL config responds with, and how often it is picked.
+// Statuses without a variant are the default responses of the URL.
+type URLHTTPStatus struct {
+	ID         int64             `json:"id"`
+	URLID      int64             `json:"url_id"`
+	VariantID  *int64            `json:"variant_id"`
+	HTTPStatus int               `json:"http_status"`
+	Percentage int               `json:"percentage"`
+	Trailers   map[string]string `json:"trailers"`    // Sent after the body, by name
+	EarlyHints []string          `json:"early_hints"` // Link header values sent in a 103 Early Hints response
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+const urlHTTPStatusColumns = `id, url_id, variant_id, http_status, percentage, trailers, early_hints, created_at, updated_at`
+
+func scanURLHTTPStatus(row scanner) (URLHTTPStatus, error) {
+	var status URLHTTPStatus
+	var variantID sql.NullInt64
+	var trailers, earlyHints []byte
+	var createdAt, updatedAt sql.NullTime
+	err := row.Scan(
+		&status.ID, &status.URLID, &variantID, &status.HTTPStatus, &status.Percentage,
+		&trailers, &earlyHints, &createdAt, &updatedAt,
+	)
+	status.VariantID = nullInt64(variantID)
+	if err == nil {
+		err = decodeJSON(trailers, &status.Trailers)
+	}
+	if err == nil {
+		err = decodeJSON(earlyHints, &status.EarlyHints)
+	}
+	status.CreatedAt = createdAt.Time
+	status.UpdatedAt = updatedAt.Time
+	return status, err
+}
+
+// GetURLHTTPStatus returns the HTTP status with the id
+func (q *Queries) GetURLHTTPStatus(ctx context.Context, id int64) (URLHTTPStatus, error) {
+	return queryOne(ctx, q.db, scanURLHTTPStatus, "SELECT "+urlHTTPStatusColumns+" FROM url_http_status WHERE id = $1", id)
+}
+
+// ListURLHTTPStatuses returns the statuses of the URL in the variant, or its default statuses
+// when variantID is nil, in creation order
+func (q *Queries) ListURLHTTPStatuses(ctx context.Context, urlID int64, variantID *int64) ([]URLHTTPStatus, error) {
+	return queryAll(ctx, q.db, scanURLHTTPStatus,
+		"SELECT "+urlHTTPStatusColumns+" FROM url_http_status WHERE url_id = $1 AND variant_id IS NOT DISTINCT FROM $2 ORDER BY id",
+		urlID, variantID,
+	)
+}
+
+// ListURLHTTPStatusesByProject returns the statuses of every URL config of the project, in creation order
+func (q *Queries) ListURLHTTPStatusesByProject(ctx context.Context, projectID int64) ([]URLHTTPStatus, error) {
+	return queryAll(ctx, q.db, scanURLHTTPStatus,
+		`SELECT s.id, s.url_id, s.variant_id, s.http_status, s.percentage, s.trailers, s.early_hints, s.created_at, s.updated_at
+		FROM url_http_status s
+		JOIN url_config uc ON uc.id = s.url_id
+		WHERE uc.project_id = $1
+		ORDER BY s.id`,
+		projectID,
+	)
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/metrics"
+	"github.com/adolfooes/api_faker/pkg/utils/response"
+)
+
+// NewMetrics returns the server of the Prometheus metrics, on METRICS_ADDR so they aren't exposed on the API
+// listener, or nil when METRICS_ADDR is empty. With METRICS_TOKEN, scrapers must send it as a bearer token.
+func NewMetrics() *http.Server {
+	settings := config.GetMetrics()
+	if settings.Address == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", requireToken(settings.Token, metrics.Handler()))
+
+	return &http.Server{
+		Addr:              settings.Address,
+		Handler:           mux,
+		ReadHeaderTimeout: config.GetServerReadHeaderTimeout(),
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// StartMetrics listens on the address of the metrics server and serves it in the background until it is shut down.
+// Only failing to listen is returned, so a port already in use stops the startup.
+func StartMetrics(srv *http.Server) error {
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Metrics server failed", "error", err)
+		}
+	}()
+
+	slog.Info("Metrics server is running", "address", srv.Addr)
+	return nil
+}
+
+// requireToken lets a request through to h only with the bearer token, when one is configured
+func requireToken(token string, h http.Handler) http.Handler {
+	if token == "" {
+		return h
+	}
+	expected := []byte("Bearer " + token)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			response.SendResponse(w, http.StatusUnauthorized, "Unauthorized: invalid metrics token", "", nil, false)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
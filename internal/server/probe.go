@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/adolfooes/api_faker/config"
+)
+
+// ProbeURL returns the URL of path on the server as configured, reached over the loopback interface: https when
+// TLS is configured, and the port of SERVER_ADDR
+func ProbeURL(path string) (string, error) {
+	host, port, err := net.SplitHostPort(config.GetServerAddress())
+	if err != nil {
+		return "", fmt.Errorf("invalid server address %q: %w", config.GetServerAddress(), err)
+	}
+
+	// A server listening on every interface is reached on the loopback one
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+
+	scheme := "http"
+	if settings := config.GetTLS(); settings.Auto || settings.CertFile != "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, port), path), nil
+}
+
+// Probe requests path on the running server, as configured, and returns an error unless it answers 200
+func Probe(ctx context.Context, path string) error {
+	url, err := ProbeURL(path)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	// The server probes itself, so its certificate isn't verified: it may be issued for another name than
+	// the one it is reached on, or by a CA the system doesn't trust
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return nil
+}
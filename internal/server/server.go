@@ -0,0 +1,97 @@
+// Package server runs the HTTP server and shuts it down gracefully
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/api/handler"
+)
+
+// New returns the HTTP server of handler, configured from the settings. It serves HTTPS when TLS is configured.
+func New(h http.Handler) (*http.Server, error) {
+	tlsConfig, err := tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http.Server{
+		Addr:              config.GetServerAddress(),
+		Handler:           h,
+		ReadHeaderTimeout: config.GetServerReadHeaderTimeout(),
+		ReadTimeout:       config.GetServerReadTimeout(),
+		WriteTimeout:      config.GetServerWriteTimeout(),
+		IdleTimeout:       config.GetServerIdleTimeout(),
+		MaxHeaderBytes:    config.GetServerMaxHeaderBytes(),
+		// Errors of the server itself, e.g. malformed requests, are logged like the rest
+		ErrorLog:  slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		TLSConfig: tlsConfig,
+	}
+
+	configureHTTP2(srv)
+	return srv, nil
+}
+
+// configureHTTP2 sets the protocols of the server: HTTP/2 negotiated over TLS unless SERVER_HTTP2 is off,
+// and HTTP/2 with prior knowledge over cleartext connections with SERVER_H2C. Both are served by net/http
+// itself, so Shutdown sends GOAWAY to HTTP/2 connections and waits for their streams like for other requests.
+func configureHTTP2(srv *http.Server) {
+	enabled, cleartext := config.GetServerHTTP2()
+
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(enabled)
+	srv.Protocols.SetUnencryptedHTTP2(cleartext)
+	srv.HTTP2 = &http.HTTP2Config{MaxConcurrentStreams: config.GetServerHTTP2MaxStreams()}
+}
+
+// Run serves requests until ctx is done, then shuts the server down: it reports itself unready, keeps
+// serving for SHUTDOWN_DELAY, stops accepting connections and waits up to SHUTDOWN_TIMEOUT for the
+// requests in flight to finish. The connections of the requests still running after that are closed.
+func Run(ctx context.Context, srv *http.Server) error {
+	errs := make(chan error, 1)
+	go func() {
+		// The certificates are already in the TLS configuration
+		if srv.TLSConfig != nil {
+			errs <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		errs <- srv.ListenAndServe()
+	}()
+
+	slog.Info("Server is running", "address", srv.Addr, "tls", srv.TLSConfig != nil)
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down the server")
+	handler.StartDraining()
+
+	if delay := config.GetShutdownDelay(); delay > 0 {
+		time.Sleep(delay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.GetShutdownTimeout())
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("requests were still running after the shutdown timeout: %w", err)
+	}
+
+	// ListenAndServe returns as soon as the shutdown starts
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	slog.Info("Server stopped")
+	return nil
+}
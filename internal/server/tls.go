@@ -0,0 +1,65 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/adolfooes/api_faker/config"
+	"github.com/adolfooes/api_faker/internal/pki"
+)
+
+// tlsConfig returns the TLS configuration of the server, nil when it serves plain HTTP. In auto mode the
+// CA is loaded, or generated, and issues the project certificates.
+func tlsConfig() (*tls.Config, error) {
+	settings := config.GetTLS()
+	if !settings.Auto && settings.CertFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	clientCAs := x509.NewCertPool()
+	verifiesClients := false
+
+	if settings.Auto {
+		ca, err := pki.LoadOrCreate(settings.CADir)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := ca.ServerCertificate(settings.Hosts)
+		if err != nil {
+			return nil, fmt.Errorf("error issuing the server certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		clientCAs.AddCert(ca.Certificate())
+		verifiesClients = true
+		pki.SetDefault(ca)
+	} else {
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the TLS certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if settings.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(settings.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the client CA file: %w", err)
+		}
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificate found in the client CA file %s", settings.ClientCAFile)
+		}
+		verifiesClients = true
+	}
+
+	// Client certificates are verified when given, but not required: the projects requiring mTLS
+	// reject the requests without one themselves
+	if verifiesClients {
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
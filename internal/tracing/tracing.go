@@ -0,0 +1,87 @@
+// Package tracing exports OpenTelemetry traces of the requests served by the faker, and honors the
+// W3C traceparent of incoming requests so the faker joins the traces of the systems under test.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/adolfooes/api_faker/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of every span started by the faker
+const instrumentationName = "github.com/adolfooes/api_faker"
+
+// tracer is looked up once, the global tracers delegate to the provider installed later by Setup
+var tracer = otel.Tracer(instrumentationName)
+
+// Tracer returns the tracer the faker starts its spans with
+func Tracer() trace.Tracer {
+	return tracer
+}
+
+// Start starts a span as a child of the span of ctx. When that span isn't recorded, because tracing is off or
+// the request isn't sampled, ctx is returned with its own span instead, so untraced requests don't pay for the
+// spans of their steps. Ending that span is a no-op.
+func Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if parent := trace.SpanFromContext(ctx); !parent.IsRecording() {
+		return ctx, parent
+	}
+	return tracer.Start(ctx, name, options...)
+}
+
+// Setup installs the W3C trace context propagator and the exporter selected by OTEL_TRACES_EXPORTER:
+// otlp (sent over HTTP to OTEL_EXPORTER_OTLP_ENDPOINT), stdout, or none. The returned function flushes
+// the spans not exported yet and must be called before exiting.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	// Incoming trace contexts are honored even when nothing is exported, so they reach the logs
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.GetTracesExporter() {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown traces exporter %q, expected otlp, stdout or none", config.GetTracesExporter())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating the traces exporter: %w", err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the service name
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("api_faker")),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error describing the service: %w", err)
+	}
+	res, err = resource.Merge(res, resource.Environment())
+	if err != nil {
+		return nil, fmt.Errorf("error describing the service: %w", err)
+	}
+
+	// Requests follow the sampling decision of their caller, and are all sampled without one
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
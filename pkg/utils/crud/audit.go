@@ -0,0 +1,212 @@
+package crud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+// auditedTables maps each audited table to the query that resolves the project a record belongs to
+var auditedTables = map[string]string{
+	"project":         "SELECT id AS project_id FROM project WHERE id = $1",
+	"project_variant": "SELECT project_id FROM project_variant WHERE id = $1",
+	"url_config":      "SELECT project_id FROM url_config WHERE id = $1",
+	"url_http_status": `SELECT uc.project_id FROM url_http_status s
+		JOIN url_config uc ON uc.id = s.url_id
+		WHERE s.id = $1`,
+	"response_model": `SELECT uc.project_id FROM response_model m
+		JOIN url_http_status s ON s.id = m.url_http_status_id
+		JOIN url_config uc ON uc.id = s.url_id
+		WHERE m.id = $1`,
+}
+
+// CreateAudited inserts a record like Create and records the change in the audit log.
+// Versioned tables also get their first revision. The record and its audit are written in one
+// transaction, so a change is never saved without its audit.
+func CreateAudited(ctx context.Context, actorID int64, table string, columns []string, values []interface{}) (Row, error) {
+	var created Row
+	err := WithTx(ctx, func(tx *Tx) error {
+		var err error
+		created, err = tx.CreateAudited(actorID, table, columns, values)
+		return err
+	})
+	return created, err
+}
+
+// UpdateAudited updates a record like Update and records the before and after states in the audit log.
+// Versioned tables also get a new revision. Both are written in one transaction with the update.
+func UpdateAudited(ctx context.Context, actorID int64, table string, id int64, updates map[string]interface{}) (Row, error) {
+	var updated Row
+	err := WithTx(ctx, func(tx *Tx) error {
+		var err error
+		updated, err = tx.UpdateAudited(actorID, table, id, updates)
+		return err
+	})
+	return updated, err
+}
+
+// DeleteAudited removes a record like Delete and records its last state in the audit log, in one transaction
+func DeleteAudited(ctx context.Context, actorID int64, table string, id int64) error {
+	return WithTx(ctx, func(tx *Tx) error {
+		return tx.DeleteAudited(actorID, table, id)
+	})
+}
+
+func createAudited(q executor, changes changeSet, actorID int64, table string, columns []string, values []interface{}) (Row, error) {
+	created, err := createRecord(q, table, columns, values)
+	if err != nil {
+		return nil, err
+	}
+
+	if id, ok := created.NullInt64("id"); ok {
+		projectID, err := resolveProjectID(q, table, id)
+		if err != nil {
+			return nil, err
+		}
+		changes.add(projectID)
+		if err := recordAudit(q, actorID, table, id, projectID, AuditActionCreate, nil, created); err != nil {
+			return nil, err
+		}
+		if IsVersioned(table) {
+			if err := saveRevision(q, actorID, table, id, created); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return created, nil
+}
+
+func updateAudited(q executor, changes changeSet, actorID int64, table string, id int64, updates map[string]interface{}) (Row, error) {
+	before, err := readRecord(q, table, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// A record moved to another project (e.g. a URL config) changes both projects
+	previousProjectID, err := resolveProjectID(q, table, id)
+	if err != nil {
+		return nil, err
+	}
+	changes.add(previousProjectID)
+
+	updated, err := updateRecord(q, table, id, updates)
+	if err != nil {
+		return nil, err
+	}
+
+	projectID, err := resolveProjectID(q, table, id)
+	if err != nil {
+		return nil, err
+	}
+	changes.add(projectID)
+	if err := recordAudit(q, actorID, table, id, projectID, AuditActionUpdate, before, updated); err != nil {
+		return nil, err
+	}
+	if IsVersioned(table) {
+		if err := ensureBaseRevision(q, table, id, before); err != nil {
+			return nil, err
+		}
+		if err := saveRevision(q, actorID, table, id, updated); err != nil {
+			return nil, err
+		}
+	}
+
+	return updated, nil
+}
+
+func deleteAudited(q executor, changes changeSet, actorID int64, table string, id int64) error {
+	before, err := readRecord(q, table, id)
+	if err != nil {
+		return err
+	}
+
+	// The project has to be resolved while the record still exists
+	projectID, err := resolveProjectID(q, table, id)
+	if err != nil {
+		return err
+	}
+
+	if err := deleteRecord(q, table, id); err != nil {
+		return err
+	}
+
+	changes.add(projectID)
+	return recordAudit(q, actorID, table, id, projectID, AuditActionDelete, before, nil)
+}
+
+// resolveProjectID returns the project a record belongs to, or nil when it doesn't belong to one
+func resolveProjectID(q executor, table string, id int64) (interface{}, error) {
+	query, ok := auditedTables[table]
+	if !ok {
+		return nil, nil
+	}
+
+	results, _, err := rawQuery(q, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving project of %s %d: %w", table, id, err)
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	return results[0]["project_id"], nil
+}
+
+// recordAudit writes an audit log entry. It runs in the transaction of the audited change,
+// which is rolled back when the entry can't be written.
+func recordAudit(q executor, actorID int64, table string, recordID int64, projectID interface{}, action string, before map[string]interface{}, after map[string]interface{}) error {
+	beforeJSON, err := auditSnapshot(before)
+	if err != nil {
+		return fmt.Errorf("error recording audit of %s %d: %w", table, recordID, err)
+	}
+
+	afterJSON, err := auditSnapshot(after)
+	if err != nil {
+		return fmt.Errorf("error recording audit of %s %d: %w", table, recordID, err)
+	}
+
+	columns := []string{"project_id", "actor_id", "table_name", "record_id", "action", "before", "after"}
+	values := []interface{}{projectID, actorID, table, recordID, action, beforeJSON, afterJSON}
+	if _, err := createRecord(q, "audit_log", columns, values); err != nil {
+		return fmt.Errorf("error recording audit of %s %d: %w", table, recordID, err)
+	}
+	return nil
+}
+
+// auditSnapshot encodes a record as JSON, keeping JSONB columns as nested JSON
+func auditSnapshot(record map[string]interface{}) (interface{}, error) {
+	if record == nil {
+		return nil, nil
+	}
+
+	snapshot := make(map[string]interface{}, len(record))
+	for key, value := range record {
+		switch v := value.(type) {
+		case []byte:
+			if json.Valid(v) {
+				snapshot[key] = json.RawMessage(v)
+			} else {
+				snapshot[key] = string(v)
+			}
+		case time.Time:
+			snapshot[key] = v.Format(time.RFC3339Nano)
+		default:
+			snapshot[key] = v
+		}
+	}
+
+	encoded, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding snapshot: %w", err)
+	}
+	return string(encoded), nil
+}
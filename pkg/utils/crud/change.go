@@ -0,0 +1,40 @@
+package crud
+
+import "sync"
+
+var (
+	projectChangeMu        sync.RWMutex
+	projectChangeListeners []func(projectID int64)
+)
+
+// OnProjectChange registers fn to be called with the project of every record written by an audited
+// create, update or delete, or marked with Tx.ProjectChanged. It is called once the write is committed, so fn reads the new state.
+func OnProjectChange(fn func(projectID int64)) {
+	projectChangeMu.Lock()
+	defer projectChangeMu.Unlock()
+	projectChangeListeners = append(projectChangeListeners, fn)
+}
+
+// changeSet collects the projects changed by the audited writes of a call or a transaction,
+// so they are announced once, after the commit
+type changeSet map[int64]bool
+
+// add records the change of a project, as resolved by resolveProjectID
+func (c changeSet) add(projectID interface{}) {
+	if id, ok := projectID.(int64); ok {
+		c[id] = true
+	}
+}
+
+// publish calls the listeners registered with OnProjectChange for each changed project
+func (c changeSet) publish() {
+	projectChangeMu.RLock()
+	listeners := projectChangeListeners
+	projectChangeMu.RUnlock()
+
+	for projectID := range c {
+		for _, listener := range listeners {
+			listener(projectID)
+		}
+	}
+}
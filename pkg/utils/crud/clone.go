@@ -0,0 +1,174 @@
+package crud
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// CloneProject deep-copies a project with its variants, URL configs, URL HTTP statuses, response models
+// and OIDC clients and users into a new project owned by ownerID. The OIDC clients and users, with their
+// secrets and password hashes, are only copied with withOIDC. Everything is copied in a single
+// transaction, so a failed clone leaves nothing behind. It returns the new project.
+func CloneProject(ctx context.Context, ownerID int64, projectID int64, name string, withOIDC bool) (Row, error) {
+	var cloned Row
+	err := WithTx(ctx, func(tx *Tx) error {
+		q, cancel := tx.executor()
+		defer cancel()
+
+		var err error
+		cloned, err = cloneProject(q, ownerID, projectID, name, withOIDC)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cloned, nil
+}
+
+func cloneProject(tx executor, ownerID int64, projectID int64, name string, withOIDC bool) (Row, error) {
+	// Parameters in the INSERT ... SELECT lists are cast, Postgres doesn't infer their types from the target columns
+	var newProjectID int64
+	err := tx.QueryRow(
+		`INSERT INTO project (owner_id, name, description, type, is_active, require_client_cert, protocols, server_push)
+		SELECT $2::int, $3::varchar, description, type, is_active, require_client_cert, protocols, server_push FROM project WHERE id = $1 RETURNING id`,
+		projectID, ownerID, name,
+	).Scan(&newProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("error cloning project %d: %w", projectID, err)
+	}
+
+	// Old ids are mapped to the ids of their copies, so the children can point at the new parents
+	variantIDs, err := cloneRows(tx, "project_variant",
+		"SELECT id FROM project_variant WHERE project_id = $1 ORDER BY id", []interface{}{projectID},
+		func(ids []sql.NullInt64) []interface{} { return []interface{}{ids[0].Int64, newProjectID} },
+		`INSERT INTO project_variant (project_id, name, description, fallback_http_status, fallback_model, client_subject)
+		SELECT $2::int, name, description, fallback_http_status, fallback_model, client_subject FROM project_variant WHERE id = $1 RETURNING id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	urlIDs, err := cloneRows(tx, "url_config",
+		"SELECT id FROM url_config WHERE project_id = $1 ORDER BY id", []interface{}{projectID},
+		func(ids []sql.NullInt64) []interface{} { return []interface{}{ids[0].Int64, newProjectID} },
+		`INSERT INTO url_config (project_id, path, method, description)
+		SELECT $2::int, path, method, description FROM url_config WHERE id = $1 RETURNING id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	statusIDs, err := cloneRows(tx, "url_http_status",
+		`SELECT s.id, s.url_id, s.variant_id FROM url_http_status s
+		JOIN url_config uc ON uc.id = s.url_id
+		WHERE uc.project_id = $1 ORDER BY s.id`, []interface{}{projectID},
+		func(ids []sql.NullInt64) []interface{} {
+			var variantID interface{}
+			if ids[2].Valid {
+				variantID = variantIDs[ids[2].Int64]
+			}
+			return []interface{}{ids[0].Int64, urlIDs[ids[1].Int64], variantID}
+		},
+		`INSERT INTO url_http_status (url_id, http_status, percentage, variant_id, trailers, early_hints)
+		SELECT $2::int, http_status, percentage, $3::int, trailers, early_hints FROM url_http_status WHERE id = $1 RETURNING id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = cloneRows(tx, "response_model",
+		`SELECT m.id, m.url_http_status_id FROM response_model m
+		JOIN url_http_status s ON s.id = m.url_http_status_id
+		JOIN url_config uc ON uc.id = s.url_id
+		WHERE uc.project_id = $1 ORDER BY m.id`, []interface{}{projectID},
+		func(ids []sql.NullInt64) []interface{} { return []interface{}{ids[0].Int64, statusIDs[ids[1].Int64]} },
+		`INSERT INTO response_model (url_http_status_id, model, description)
+		SELECT $2::int, model, description FROM response_model WHERE id = $1 RETURNING id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// OIDC clients and users are only scoped by project, the signing key is left for the new issuer to generate
+	if withOIDC {
+		for _, query := range []string{
+			`INSERT INTO oidc_client (project_id, client_id, client_secret, redirect_uris)
+			SELECT $2::int, client_id, client_secret, redirect_uris FROM oidc_client WHERE project_id = $1`,
+			`INSERT INTO oidc_user (project_id, username, password, claims)
+			SELECT $2::int, username, password, claims FROM oidc_user WHERE project_id = $1`,
+		} {
+			if _, err := tx.Exec(query, projectID, newProjectID); err != nil {
+				return nil, fmt.Errorf("error cloning OIDC configuration: %w", err)
+			}
+		}
+	}
+
+	// The copy serves the copy of the original's active variant
+	var activeVariantID sql.NullInt64
+	if err := tx.QueryRow("SELECT active_variant_id FROM project WHERE id = $1", projectID).Scan(&activeVariantID); err != nil {
+		return nil, fmt.Errorf("error reading active variant: %w", err)
+	}
+	if activeVariantID.Valid {
+		_, err = tx.Exec("UPDATE project SET active_variant_id = $2 WHERE id = $1", newProjectID, variantIDs[activeVariantID.Int64])
+		if err != nil {
+			return nil, fmt.Errorf("error cloning active variant: %w", err)
+		}
+	}
+
+	cloned, err := readRecord(tx, "project", newProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := recordAudit(tx, ownerID, "project", newProjectID, newProjectID, AuditActionCreate, nil, cloned); err != nil {
+		return nil, err
+	}
+
+	return cloned, nil
+}
+
+// cloneRows copies the rows selected by listQuery with insertQuery and returns the ids of the copies by original id.
+// listQuery returns the original id first, followed by any ids args needs to build the insert arguments.
+func cloneRows(tx executor, table string, listQuery string, listArgs []interface{}, args func(ids []sql.NullInt64) []interface{}, insertQuery string) (map[int64]int64, error) {
+	rows, err := tx.Query(listQuery, listArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s to clone: %w", table, err)
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("error retrieving columns: %w", err)
+	}
+
+	// All the rows are read before inserting, a transaction can only run one statement at a time
+	var originals [][]sql.NullInt64
+	for rows.Next() {
+		ids := make([]sql.NullInt64, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range ids {
+			ptrs[i] = &ids[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning %s to clone: %w", table, err)
+		}
+		originals = append(originals, ids)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over %s to clone: %w", table, err)
+	}
+
+	copies := make(map[int64]int64, len(originals))
+	for _, ids := range originals {
+		var newID int64
+		if err := tx.QueryRow(insertQuery, args(ids)...).Scan(&newID); err != nil {
+			return nil, fmt.Errorf("error cloning %s %d: %w", table, ids[0].Int64, err)
+		}
+		copies[ids[0].Int64] = newID
+	}
+
+	return copies, nil
+}
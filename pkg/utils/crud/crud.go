@@ -1,19 +1,158 @@
 package crud
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/adolfooes/api_faker/internal/db"
+	"github.com/adolfooes/api_faker/internal/metrics"
+	"github.com/adolfooes/api_faker/internal/tracing"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// executor runs the queries of one crud call, see withContext
+type executor interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+
+	// context returns the context the queries run with
+	context() context.Context
+	// withContext returns an executor running the queries on the same connection with ctx
+	withContext(ctx context.Context) executor
+}
+
+// conn runs queries with a context, both *sql.DB and *sql.Tx implement it
+type conn interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// contextExecutor runs the queries on a connection with the context of the crud call
+type contextExecutor struct {
+	conn conn
+	ctx  context.Context
+}
+
+func (e contextExecutor) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return e.conn.QueryContext(e.ctx, query, args...)
+}
+
+func (e contextExecutor) QueryRow(query string, args ...interface{}) *sql.Row {
+	return e.conn.QueryRowContext(e.ctx, query, args...)
+}
+
+func (e contextExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return e.conn.ExecContext(e.ctx, query, args...)
+}
+
+func (e contextExecutor) context() context.Context {
+	return e.ctx
+}
+
+func (e contextExecutor) withContext(ctx context.Context) executor {
+	return contextExecutor{conn: e.conn, ctx: ctx}
+}
+
+// observe starts the span of a database operation. It returns an executor running the queries of the
+// operation inside the span, and the function that ends the span and records the operation in the metrics.
+func observe(q executor, operation string, table string) (executor, func(err *error)) {
+	start := time.Now()
+
+	ctx, span := tracing.Start(q.context(), "db."+operation, trace.WithSpanKind(trace.SpanKindClient))
+	if span.IsRecording() {
+		span.SetAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(operation))
+		if table != "" {
+			span.SetAttributes(semconv.DBCollectionName(table))
+		}
+	}
+
+	return q.withContext(ctx), func(err *error) {
+		if *err != nil {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+		metrics.ObserveQuery(operation, table, start, err)
+	}
+}
+
+// withContext returns an executor running the queries of one crud call on c. The queries are cancelled with
+// ctx, and once the configured query timeout has passed; the returned function must be called when the call ends.
+func withContext(ctx context.Context, c conn) (executor, context.CancelFunc) {
+	ctx, cancel := db.WithQueryTimeout(ctx)
+	return contextExecutor{conn: c, ctx: ctx}, cancel
+}
+
 // Create inserts a new record into the table and returns the created record
-func Create(table string, columns []string, values []interface{}) (map[string]interface{}, error) {
+func Create(ctx context.Context, table string, columns []string, values []interface{}) (Row, error) {
+	q, cancel := withContext(ctx, db.GetDB())
+	defer cancel()
+	return createRecord(q, table, columns, values)
+}
+
+// Read retrieves a record from the table based on the ID
+func Read(ctx context.Context, table string, id int64) (Row, error) {
+	q, cancel := withContext(ctx, db.GetDB())
+	defer cancel()
+	return readRecord(q, table, id)
+}
+
+// List retrieves records based on a table and a map of key and values
+func List(ctx context.Context, table string, filters map[string]interface{}) ([]Row, error) {
+	q, cancel := withContext(ctx, db.GetDB())
+	defer cancel()
+	return listRecords(q, table, filters)
+}
+
+// Update updates a record based on a table and ID, and returns the updated record dynamically
+func Update(ctx context.Context, table string, id int64, updates map[string]interface{}) (Row, error) {
+	q, cancel := withContext(ctx, db.GetDB())
+	defer cancel()
+	return updateRecord(q, table, id, updates)
+}
+
+// Delete removes a record based on a table and ID
+func Delete(ctx context.Context, table string, id int64) error {
+	q, cancel := withContext(ctx, db.GetDB())
+	defer cancel()
+	return deleteRecord(q, table, id)
+}
+
+// Raw executes any SQL command (SELECT, INSERT, UPDATE, DELETE, etc.). Its rows are not
+// converted with the schema, so enums and JSONB are returned as bytes; the Row accessors read both.
+func Raw(ctx context.Context, query string, args ...interface{}) ([]Row, int64, error) {
+	q, cancel := withContext(ctx, db.GetDB())
+	defer cancel()
+	return rawQuery(q, query, args...)
+}
+
+// createRecord inserts a new record into the table and returns the created record
+func createRecord(q executor, table string, columns []string, values []interface{}) (_ Row, err error) {
+	q, done := observe(q, "create", table)
+	defer done(&err)
+
 	if len(columns) != len(values) {
 		return nil, fmt.Errorf("number of columns does not match the number of values")
 	}
 
-	columnsStr := strings.Join(columns, ", ")
+	quotedTable, err := quoteTable(table)
+	if err != nil {
+		return nil, err
+	}
+	quotedColumns, err := quoteColumns(table, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	columnsStr := strings.Join(quotedColumns, ", ")
 	placeholders := make([]string, len(values))
 	for i := range placeholders {
 		placeholders[i] = fmt.Sprintf("$%d", i+1)
@@ -21,19 +160,19 @@ func Create(table string, columns []string, values []interface{}) (map[string]in
 	placeholdersStr := strings.Join(placeholders, ", ")
 
 	// The RETURNING * will return all the columns of the newly inserted record
-	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING *", table, columnsStr, placeholdersStr)
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING *", quotedTable, columnsStr, placeholdersStr)
 
 	// Execute the query and retrieve the rows
-	rows, err := db.GetDB().Query(query, values...)
+	rows, err := q.Query(query, values...)
 	if err != nil {
-		return nil, fmt.Errorf("error executing query: %v", err)
+		return nil, fmt.Errorf("error executing query: %w", err)
 	}
 	defer rows.Close()
 
 	// Retrieve the column names dynamically from the table
 	columns, err = rows.Columns()
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving columns: %v", err)
+		return nil, fmt.Errorf("error retrieving columns: %w", err)
 	}
 
 	valuesPtrs := make([]interface{}, len(columns))
@@ -46,28 +185,30 @@ func Create(table string, columns []string, values []interface{}) (map[string]in
 	if rows.Next() {
 		err := rows.Scan(valuesPtrs...)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning row: %v", err)
+			return nil, fmt.Errorf("error scanning row: %w", err)
 		}
 	}
 
-	// Create a map to store the result dynamically
-	result := make(map[string]interface{})
-	for i, col := range columns {
-		result[col] = db.TranslateEnumValue(table, col, valuesArr[i])
-	}
-
-	return result, nil
+	return newRow(table, columns, valuesArr), nil
 }
 
-// Read retrieves a record from the table based on the ID
-func Read(table string, id int64) (map[string]interface{}, error) {
+// readRecord retrieves a record from the table based on the ID
+func readRecord(q executor, table string, id int64) (_ Row, err error) {
+	q, done := observe(q, "read", table)
+	defer done(&err)
+
+	quotedTable, err := quoteTable(table)
+	if err != nil {
+		return nil, err
+	}
+
 	// Construct the query to fetch a record by ID
-	query := fmt.Sprintf("SELECT * FROM %s WHERE id = $1", table)
+	query := fmt.Sprintf("SELECT * FROM %s WHERE id = $1", quotedTable)
 
 	// Execute the query and get the row
-	rows, err := db.GetDB().Query(query, id)
+	rows, err := q.Query(query, id)
 	if err != nil {
-		return nil, fmt.Errorf("error executing query: %v", err)
+		return nil, fmt.Errorf("error executing query: %w", err)
 	}
 	defer rows.Close()
 
@@ -79,7 +220,7 @@ func Read(table string, id int64) (map[string]interface{}, error) {
 	// Get the column names dynamically
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, fmt.Errorf("error getting columns: %v", err)
+		return nil, fmt.Errorf("error getting columns: %w", err)
 	}
 
 	// Create slices to store the row's values
@@ -92,25 +233,31 @@ func Read(table string, id int64) (map[string]interface{}, error) {
 	// Scan the row's values into the pointers
 	err = rows.Scan(valuePtrs...)
 	if err != nil {
-		return nil, fmt.Errorf("error scanning row: %v", err)
-	}
-
-	// Create a map to store the results
-	result := make(map[string]interface{})
-	for i, col := range columns {
-		result[col] = db.TranslateEnumValue(table, col, values[i])
+		return nil, fmt.Errorf("error scanning row: %w", err)
 	}
 
-	return result, nil
+	return newRow(table, columns, values), nil
 }
 
-// List retrieves records based on a table and a map of key and values
-func List(table string, filters map[string]interface{}) ([]map[string]interface{}, error) {
+// listRecords retrieves records based on a table and a map of key and values
+func listRecords(q executor, table string, filters map[string]interface{}) (_ []Row, err error) {
+	q, done := observe(q, "list", table)
+	defer done(&err)
+
+	quotedTable, err := quoteTable(table)
+	if err != nil {
+		return nil, err
+	}
+
 	var whereClauses []string
 	var args []interface{}
 	i := 1
 	for key, value := range filters {
-		whereClauses = append(whereClauses, fmt.Sprintf("%s = $%d", key, i))
+		column, err := quoteColumn(table, key)
+		if err != nil {
+			return nil, err
+		}
+		whereClauses = append(whereClauses, fmt.Sprintf("%s = $%d", column, i))
 		args = append(args, value)
 		i++
 	}
@@ -118,22 +265,22 @@ func List(table string, filters map[string]interface{}) ([]map[string]interface{
 	var query string
 	if len(whereClauses) > 0 {
 		whereClause := strings.Join(whereClauses, " AND ")
-		query = fmt.Sprintf("SELECT * FROM %s WHERE %s", table, whereClause)
+		query = fmt.Sprintf("SELECT * FROM %s WHERE %s", quotedTable, whereClause)
 	} else {
 		// If no filters, just select all records
-		query = fmt.Sprintf("SELECT * FROM %s", table)
+		query = fmt.Sprintf("SELECT * FROM %s", quotedTable)
 	}
 
-	rows, err := db.GetDB().Query(query, args...)
+	rows, err := q.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("error listing records: %v", err)
+		return nil, fmt.Errorf("error listing records: %w", err)
 	}
 	defer rows.Close()
 
-	var results []map[string]interface{}
+	var results []Row
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, fmt.Errorf("error getting columns: %v", err)
+		return nil, fmt.Errorf("error getting columns: %w", err)
 	}
 
 	for rows.Next() {
@@ -145,30 +292,38 @@ func List(table string, filters map[string]interface{}) ([]map[string]interface{
 
 		err := rows.Scan(valuePtrs...)
 		if err != nil {
-			return nil, fmt.Errorf("error reading record: %v", err)
+			return nil, fmt.Errorf("error reading record: %w", err)
 		}
 
-		result := make(map[string]interface{})
-		for i, col := range columns {
-			result[col] = db.TranslateEnumValue(table, col, values[i])
-		}
-		results = append(results, result)
+		results = append(results, newRow(table, columns, values))
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over records: %v", err)
+		return nil, fmt.Errorf("error iterating over records: %w", err)
 	}
 
 	return results, nil
 }
 
-// Update updates a record based on a table and ID, and returns the updated record dynamically
-func Update(table string, id int64, updates map[string]interface{}) (map[string]interface{}, error) {
+// updateRecord updates a record based on a table and ID, and returns the updated record dynamically
+func updateRecord(q executor, table string, id int64, updates map[string]interface{}) (_ Row, err error) {
+	q, done := observe(q, "update", table)
+	defer done(&err)
+
+	quotedTable, err := quoteTable(table)
+	if err != nil {
+		return nil, err
+	}
+
 	var setClauses []string
 	var args []interface{}
 	i := 1
 	for key, value := range updates {
-		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", key, i))
+		column, err := quoteColumn(table, key)
+		if err != nil {
+			return nil, err
+		}
+		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", column, i))
 		args = append(args, value)
 		i++
 	}
@@ -179,12 +334,12 @@ func Update(table string, id int64, updates map[string]interface{}) (map[string]
 	args = append(args, id)
 
 	// Build the query using RETURNING * to return the updated row
-	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d RETURNING *", table, setClause, i)
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d RETURNING *", quotedTable, setClause, i)
 
 	// Use Query to get sql.Rows for dynamically getting columns
-	rows, err := db.GetDB().Query(query, args...)
+	rows, err := q.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("error executing update query: %v", err)
+		return nil, fmt.Errorf("error executing update query: %w", err)
 	}
 	defer rows.Close()
 
@@ -196,7 +351,7 @@ func Update(table string, id int64, updates map[string]interface{}) (map[string]
 	// Retrieve the column names dynamically
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving columns: %v", err)
+		return nil, fmt.Errorf("error retrieving columns: %w", err)
 	}
 
 	// Create a slice of interfaces to hold the values dynamically
@@ -209,47 +364,53 @@ func Update(table string, id int64, updates map[string]interface{}) (map[string]
 	// Scan the row's values into the value pointers
 	err = rows.Scan(valuePtrs...)
 	if err != nil {
-		return nil, fmt.Errorf("error scanning updated row: %v", err)
-	}
-
-	// Create a map to store the result and populate it with column names and their respective values
-	result := make(map[string]interface{})
-	for i, col := range columns {
-		result[col] = db.TranslateEnumValue(table, col, values[i])
+		return nil, fmt.Errorf("error scanning updated row: %w", err)
 	}
 
-	return result, nil
+	return newRow(table, columns, values), nil
 }
 
-// Delete removes a record based on a table and ID
-func Delete(table string, id int64) error {
-	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", table)
-	_, err := db.GetDB().Exec(query, id)
+// deleteRecord removes a record based on a table and ID
+func deleteRecord(q executor, table string, id int64) (err error) {
+	q, done := observe(q, "delete", table)
+	defer done(&err)
+
+	quotedTable, err := quoteTable(table)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", quotedTable)
+	_, err = q.Exec(query, id)
 	if err != nil {
-		return fmt.Errorf("error deleting record: %v", err)
+		return fmt.Errorf("error deleting record: %w", err)
 	}
 	return nil
 }
 
-// Raw executes any SQL command (SELECT, INSERT, UPDATE, DELETE, etc.)
-func Raw(query string, args ...interface{}) ([]map[string]interface{}, int64, error) {
+// rawQuery executes any SQL command (SELECT, INSERT, UPDATE, DELETE, etc.)
+func rawQuery(q executor, query string, args ...interface{}) (_ []Row, _ int64, err error) {
+	// Raw queries can touch any table, so they are labelled as a whole
+	q, done := observe(q, "raw", "")
+	defer done(&err)
+
 	// Check if the query is a SELECT statement
 	if isSelect(query) {
 		// For SELECT queries, we return the results
-		rows, err := db.GetDB().Query(query, args...)
+		rows, err := q.Query(query, args...)
 		if err != nil {
-			return nil, 0, fmt.Errorf("error executing query: %v", err)
+			return nil, 0, fmt.Errorf("error executing query: %w", err)
 		}
 		defer rows.Close()
 
 		// Get column names dynamically
 		columns, err := rows.Columns()
 		if err != nil {
-			return nil, 0, fmt.Errorf("error getting columns: %v", err)
+			return nil, 0, fmt.Errorf("error getting columns: %w", err)
 		}
 
 		// Prepare a slice to store the results
-		var results []map[string]interface{}
+		var results []Row
 
 		// Iterate over the returned rows
 		for rows.Next() {
@@ -263,11 +424,11 @@ func Raw(query string, args ...interface{}) ([]map[string]interface{}, int64, er
 			// Scan the row's values
 			err := rows.Scan(valuePtrs...)
 			if err != nil {
-				return nil, 0, fmt.Errorf("error scanning row: %v", err)
+				return nil, 0, fmt.Errorf("error scanning row: %w", err)
 			}
 
 			// Store results in a map
-			result := make(map[string]interface{})
+			result := make(Row)
 			for i, col := range columns {
 				result[col] = values[i]
 			}
@@ -279,15 +440,15 @@ func Raw(query string, args ...interface{}) ([]map[string]interface{}, int64, er
 		return results, 0, nil
 	} else {
 		// For INSERT, UPDATE, and DELETE, we use Exec, which does not return rows
-		res, err := db.GetDB().Exec(query, args...)
+		res, err := q.Exec(query, args...)
 		if err != nil {
-			return nil, 0, fmt.Errorf("error executing non-select query: %v", err)
+			return nil, 0, fmt.Errorf("error executing non-select query: %w", err)
 		}
 
 		// Get the number of affected rows
 		rowsAffected, err := res.RowsAffected()
 		if err != nil {
-			return nil, 0, fmt.Errorf("error getting rows affected: %v", err)
+			return nil, 0, fmt.Errorf("error getting rows affected: %w", err)
 		}
 
 		// For non-SELECT queries, we return nil in results and the number of affected rows
@@ -295,9 +456,20 @@ func Raw(query string, args ...interface{}) ([]map[string]interface{}, int64, er
 	}
 }
 
-// Helper function to determine if the query is a SELECT statement
+// newRow builds the row of a record of the table from the scanned values, converted to the types of their columns
+func newRow(table string, columns []string, values []interface{}) Row {
+	row := make(Row, len(columns))
+	for i, col := range columns {
+		row[col] = convertValue(table, col, values[i])
+	}
+	return row
+}
+
+// returnsRows matches the queries returning rows: SELECT and WITH queries, and statements with a RETURNING
+// clause, whatever whitespace surrounds the keywords
+var returnsRows = regexp.MustCompile(`(?is)^\s*(SELECT|WITH)\b|\bRETURNING\b`)
+
+// Helper function to determine if the query returns rows (a SELECT or a statement with RETURNING)
 func isSelect(query string) bool {
-	// Here we check if the query starts with "SELECT"
-	// Adjust as needed for other SELECT variants.
-	return len(query) >= 6 && query[:6] == "SELECT"
+	return returnsRows.MatchString(query)
 }
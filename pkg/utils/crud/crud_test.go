@@ -0,0 +1,31 @@
+package crud
+
+import "testing"
+
+func TestIsSelect(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"select", "SELECT * FROM project", true},
+		{"lowercase select", "  select id from project", true},
+		{"with", "WITH counts AS (SELECT 1) SELECT * FROM counts", true},
+		{"insert", "INSERT INTO project (name) VALUES ($1)", false},
+		{"update", "UPDATE project SET name = $1 WHERE id = $2", false},
+		{"delete", "DELETE FROM project WHERE id = $1", false},
+		{"returning", "INSERT INTO project (name) VALUES ($1) RETURNING id", true},
+		{"multi-line returning", "INSERT INTO login_throttle (key) VALUES ($1)\n\t\tON CONFLICT (key) DO UPDATE SET failed_attempts = 1\n\t\tRETURNING failed_attempts", true},
+		{"returning after a tab", "UPDATE project SET name = $1\tRETURNING *", true},
+		{"lowercase returning", "delete from project where id = $1\nreturning id", true},
+		{"returning in a name", "UPDATE project SET returning_customers = 1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSelect(tt.query); got != tt.want {
+				t.Errorf("isSelect(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package crud
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/adolfooes/api_faker/internal/db"
+)
+
+// SortField orders a page by a column
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// Condition is an SQL boolean expression with ? placeholders for its arguments,
+// used to narrow queries beyond plain column filters
+type Condition struct {
+	Clause string
+	Args   []interface{}
+}
+
+// ListOptions narrows, orders and paginates ListPage. The columns of the filters and the sort
+// must be registered in the schema; conditions are trusted SQL and must not be built from input.
+type ListOptions struct {
+	Filters    map[string]interface{}
+	Conditions []Condition
+	Sort       []SortField
+	Limit      int
+	Offset     int
+}
+
+// ListPage retrieves one page of the records matching the filters, and the total number of matching records
+func ListPage(ctx context.Context, table string, options ListOptions) ([]Row, int64, error) {
+	q, cancel := withContext(ctx, db.GetDB())
+	defer cancel()
+	return listPage(q, table, options)
+}
+
+func listPage(q executor, table string, options ListOptions) (_ []Row, _ int64, err error) {
+	q, done := observe(q, "list_page", table)
+	defer done(&err)
+
+	quotedTable, err := quoteTable(table)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var whereClauses []string
+	var args []interface{}
+	for key, value := range options.Filters {
+		column, err := quoteColumn(table, key)
+		if err != nil {
+			return nil, 0, err
+		}
+		args = append(args, value)
+		whereClauses = append(whereClauses, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	whereClauses, args = appendConditions(whereClauses, args, options.Conditions)
+
+	where := ""
+	if len(whereClauses) > 0 {
+		where = " WHERE " + strings.Join(whereClauses, " AND ")
+	}
+
+	var total int64
+	if err := q.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s%s", quotedTable, where), args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting records: %w", err)
+	}
+
+	// The id is the last sort key, so pages are stable when the other keys tie
+	orderBy := make([]string, 0, len(options.Sort)+1)
+	sortedByID := false
+	for _, field := range options.Sort {
+		direction := "ASC"
+		if field.Desc {
+			direction = "DESC"
+		}
+		column, err := quoteColumn(table, field.Column)
+		if err != nil {
+			return nil, 0, err
+		}
+		orderBy = append(orderBy, fmt.Sprintf("%s %s", column, direction))
+		sortedByID = sortedByID || field.Column == "id"
+	}
+	if !sortedByID {
+		orderBy = append(orderBy, "id ASC")
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s%s ORDER BY %s", quotedTable, where, strings.Join(orderBy, ", "))
+	if options.Limit > 0 {
+		args = append(args, options.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if options.Offset > 0 {
+		args = append(args, options.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing records: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting columns: %w", err)
+	}
+
+	results := []Row{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range columns {
+			valuePtrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, 0, fmt.Errorf("error reading record: %w", err)
+		}
+
+		results = append(results, newRow(table, columns, values))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating over records: %w", err)
+	}
+
+	return results, total, nil
+}
+
+// ReadScoped retrieves a record like Read, but only if it also matches the conditions
+func ReadScoped(ctx context.Context, table string, id int64, conditions ...Condition) (Row, error) {
+	q, cancel := withContext(ctx, db.GetDB())
+	defer cancel()
+	results, _, err := listPage(q, table, ListOptions{
+		Filters:    map[string]interface{}{"id": id},
+		Conditions: conditions,
+		Limit:      1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no record found with id %d", id)
+	}
+	return results[0], nil
+}
+
+// appendConditions adds the conditions to the where clauses, numbering their placeholders after the existing args
+func appendConditions(whereClauses []string, args []interface{}, conditions []Condition) ([]string, []interface{}) {
+	for _, condition := range conditions {
+		var clause strings.Builder
+		argIndex := 0
+		for _, char := range condition.Clause {
+			if char == '?' && argIndex < len(condition.Args) {
+				args = append(args, condition.Args[argIndex])
+				argIndex++
+				fmt.Fprintf(&clause, "$%d", len(args))
+				continue
+			}
+			clause.WriteRune(char)
+		}
+		whereClauses = append(whereClauses, "("+clause.String()+")")
+	}
+	return whereClauses, args
+}
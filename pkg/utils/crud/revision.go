@@ -0,0 +1,104 @@
+package crud
+
+import (
+	"context"
+	"fmt"
+)
+
+// versionedTables maps each versioned table to the columns a revision can roll back
+var versionedTables = map[string][]string{
+	"url_config":      {"path", "method", "description"},
+	"url_http_status": {"http_status", "percentage", "trailers", "early_hints"},
+	"response_model":  {"model", "description"},
+}
+
+// IsVersioned reports whether changes to the table are saved as revisions
+func IsVersioned(table string) bool {
+	_, ok := versionedTables[table]
+	return ok
+}
+
+// VersionedColumns returns the columns of the table restored by a rollback
+func VersionedColumns(table string) []string {
+	return versionedTables[table]
+}
+
+// lockRevisions serializes the revisions of a record until the transaction ends, so concurrent
+// changes don't compute the same next version
+func lockRevisions(q executor, table string, recordID int64) error {
+	_, _, err := rawQuery(q, "SELECT pg_advisory_xact_lock(hashtext($1), $2::int)", table, recordID)
+	if err != nil {
+		return fmt.Errorf("error locking revisions of %s %d: %w", table, recordID, err)
+	}
+	return nil
+}
+
+// saveRevision stores a new immutable snapshot of a record with the next version number.
+// It runs in the transaction of the change, which holds the revision lock of the record until it ends.
+func saveRevision(q executor, actorID interface{}, table string, recordID int64, record map[string]interface{}) error {
+	data, err := auditSnapshot(record)
+	if err != nil {
+		return fmt.Errorf("error saving revision of %s %d: %w", table, recordID, err)
+	}
+
+	if err := lockRevisions(q, table, recordID); err != nil {
+		return err
+	}
+
+	_, _, err = rawQuery(q,
+		`INSERT INTO revision (table_name, record_id, version, data, actor_id)
+		SELECT $1::varchar, $2::int, COALESCE(MAX(version), 0) + 1, $3::jsonb, $4::int FROM revision WHERE table_name = $1 AND record_id = $2`,
+		table, recordID, data, actorID,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving revision of %s %d: %w", table, recordID, err)
+	}
+	return nil
+}
+
+// ensureBaseRevision saves the current state of a record that predates versioning as its first revision
+func ensureBaseRevision(q executor, table string, recordID int64, record map[string]interface{}) error {
+	if err := lockRevisions(q, table, recordID); err != nil {
+		return err
+	}
+
+	results, _, err := rawQuery(q, "SELECT 1 FROM revision WHERE table_name = $1 AND record_id = $2 LIMIT 1", table, recordID)
+	if err != nil {
+		return fmt.Errorf("error checking revisions of %s %d: %w", table, recordID, err)
+	}
+	if len(results) == 0 {
+		return saveRevision(q, nil, table, recordID, record)
+	}
+	return nil
+}
+
+// ListRevisions returns the revisions of a record, newest first
+func ListRevisions(ctx context.Context, table string, recordID int64) ([]Row, error) {
+	if !IsVersioned(table) {
+		return nil, fmt.Errorf("table %s is not versioned", table)
+	}
+
+	results, _, err := Raw(ctx,
+		"SELECT * FROM revision WHERE table_name = $1 AND record_id = $2 ORDER BY version DESC",
+		table, recordID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ReadRevision returns one revision of a record
+func ReadRevision(ctx context.Context, table string, recordID int64, version int) (Row, error) {
+	results, _, err := Raw(ctx,
+		"SELECT * FROM revision WHERE table_name = $1 AND record_id = $2 AND version = $3",
+		table, recordID, version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no revision %d found for %s %d", version, table, recordID)
+	}
+	return results[0], nil
+}
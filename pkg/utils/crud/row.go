@@ -0,0 +1,98 @@
+package crud
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Row is a record read from the database, keyed by column name. The accessors read a column
+// as a given type without panicking when it is NULL, missing or of another type.
+type Row map[string]interface{}
+
+// Int64 returns the column as an integer, or 0 when it is NULL or not an integer
+func (r Row) Int64(column string) int64 {
+	value, _ := r.NullInt64(column)
+	return value
+}
+
+// NullInt64 returns the column as an integer, and whether it holds one
+func (r Row) NullInt64(column string) (int64, bool) {
+	switch v := r[column].(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// Int returns the column as an int, or 0 when it is NULL or not an integer
+func (r Row) Int(column string) int {
+	return int(r.Int64(column))
+}
+
+// Float64 returns the column as a float, or 0 when it is NULL or not a number
+func (r Row) Float64(column string) float64 {
+	switch v := r[column].(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	}
+	if value, ok := r.NullInt64(column); ok {
+		return float64(value)
+	}
+	return 0
+}
+
+// String returns the column as a string, or "" when it is NULL
+func (r Row) String(column string) string {
+	switch v := r[column].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case json.RawMessage:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Bool returns the column as a boolean, or false when it is NULL or not a boolean
+func (r Row) Bool(column string) bool {
+	value, _ := r.NullBool(column)
+	return value
+}
+
+// NullBool returns the column as a boolean, and whether it holds one
+func (r Row) NullBool(column string) (bool, bool) {
+	value, ok := r[column].(bool)
+	return value, ok
+}
+
+// Time returns the column as a time, and whether it holds one
+func (r Row) Time(column string) (time.Time, bool) {
+	value, ok := r[column].(time.Time)
+	return value, ok
+}
+
+// JSON returns the encoded document of a JSON column, or nil when it is NULL
+func (r Row) JSON(column string) json.RawMessage {
+	switch v := r[column].(type) {
+	case json.RawMessage:
+		return v
+	case []byte:
+		return json.RawMessage(v)
+	case string:
+		return json.RawMessage(v)
+	}
+	return nil
+}
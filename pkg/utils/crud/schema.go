@@ -0,0 +1,248 @@
+package crud
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/adolfooes/api_faker/internal/db"
+	"github.com/lib/pq"
+)
+
+// ColumnType is the Go type the values of a column are converted to when a row is read
+type ColumnType int
+
+const (
+	ColumnInt    ColumnType = iota // int64
+	ColumnString                   // string
+	ColumnBool                     // bool
+	ColumnTime                     // time.Time
+	ColumnJSON                     // json.RawMessage
+	ColumnEnum                     // string, translated with the enum mappings of the db package
+)
+
+// schema is the registry of the tables and columns the crud functions may use. Table and column
+// names are interpolated into the queries, so anything not listed here is rejected before a query
+// is built. It must be kept in sync with the migrations.
+var schema = map[string]map[string]ColumnType{
+	"account": {
+		"id":                ColumnInt,
+		"email":             ColumnString,
+		"pending_email":     ColumnString,
+		"password":          ColumnString,
+		"role":              ColumnEnum,
+		"last_login":        ColumnTime,
+		"email_verified_at": ColumnTime,
+		"is_active":         ColumnBool,
+		"disabled_at":       ColumnTime,
+		"created_at":        ColumnTime,
+		"updated_at":        ColumnTime,
+	},
+	"account_token": {
+		"id":         ColumnInt,
+		"account_id": ColumnInt,
+		"token_hash": ColumnString,
+		"purpose":    ColumnEnum,
+		"email":      ColumnString,
+		"expires_at": ColumnTime,
+		"used_at":    ColumnTime,
+		"created_at": ColumnTime,
+	},
+	"login_throttle": {
+		"key":             ColumnString,
+		"failed_attempts": ColumnInt,
+		"locked_until":    ColumnTime,
+		"last_failed_at":  ColumnTime,
+	},
+	"security_event": {
+		"id":           ColumnInt,
+		"event":        ColumnEnum,
+		"account_id":   ColumnInt,
+		"throttle_key": ColumnString,
+		"ip_address":   ColumnString,
+		"actor_id":     ColumnInt,
+		"details":      ColumnString,
+		"created_at":   ColumnTime,
+	},
+	"project": {
+		"id":                  ColumnInt,
+		"owner_id":            ColumnInt,
+		"name":                ColumnString,
+		"description":         ColumnString,
+		"type":                ColumnEnum,
+		"active_variant_id":   ColumnInt,
+		"require_client_cert": ColumnBool,
+		"protocols":           ColumnJSON,
+		"server_push":         ColumnBool,
+		"removed_at":          ColumnTime,
+		"is_active":           ColumnBool,
+		"created_at":          ColumnTime,
+		"updated_at":          ColumnTime,
+	},
+	"project_users": {
+		"project_id":   ColumnInt,
+		"account_id":   ColumnInt,
+		"access_level": ColumnEnum,
+		"added_at":     ColumnTime,
+		"removed_at":   ColumnTime,
+		"is_active":    ColumnBool,
+	},
+	"project_variant": {
+		"id":                   ColumnInt,
+		"project_id":           ColumnInt,
+		"name":                 ColumnString,
+		"description":          ColumnString,
+		"fallback_http_status": ColumnInt,
+		"fallback_model":       ColumnJSON,
+		"client_subject":       ColumnString,
+		"created_at":           ColumnTime,
+		"updated_at":           ColumnTime,
+	},
+	"url_config": {
+		"id":          ColumnInt,
+		"project_id":  ColumnInt,
+		"path":        ColumnString,
+		"method":      ColumnEnum,
+		"description": ColumnString,
+		"created_at":  ColumnTime,
+		"updated_at":  ColumnTime,
+	},
+	"url_http_status": {
+		"id":          ColumnInt,
+		"url_id":      ColumnInt,
+		"variant_id":  ColumnInt,
+		"http_status": ColumnInt,
+		"percentage":  ColumnInt,
+		"trailers":    ColumnJSON,
+		"early_hints": ColumnJSON,
+		"created_at":  ColumnTime,
+		"updated_at":  ColumnTime,
+	},
+	"response_model": {
+		"id":                 ColumnInt,
+		"url_http_status_id": ColumnInt,
+		"model":              ColumnJSON,
+		"description":        ColumnString,
+		"created_at":         ColumnTime,
+		"updated_at":         ColumnTime,
+	},
+	"oidc_signing_key": {
+		"project_id":  ColumnInt,
+		"kid":         ColumnString,
+		"private_key": ColumnString,
+		"created_at":  ColumnTime,
+	},
+	"oidc_client": {
+		"id":            ColumnInt,
+		"project_id":    ColumnInt,
+		"client_id":     ColumnString,
+		"client_secret": ColumnString,
+		"redirect_uris": ColumnJSON,
+		"created_at":    ColumnTime,
+		"updated_at":    ColumnTime,
+	},
+	"oidc_user": {
+		"id":         ColumnInt,
+		"project_id": ColumnInt,
+		"username":   ColumnString,
+		"password":   ColumnString,
+		"claims":     ColumnJSON,
+		"created_at": ColumnTime,
+		"updated_at": ColumnTime,
+	},
+	"oidc_authorization_code": {
+		"code":                  ColumnString,
+		"project_id":            ColumnInt,
+		"client_id":             ColumnString,
+		"user_id":               ColumnInt,
+		"redirect_uri":          ColumnString,
+		"scope":                 ColumnString,
+		"nonce":                 ColumnString,
+		"code_challenge":        ColumnString,
+		"code_challenge_method": ColumnString,
+		"expires_at":            ColumnTime,
+		"created_at":            ColumnTime,
+	},
+	"audit_log": {
+		"id":         ColumnInt,
+		"project_id": ColumnInt,
+		"actor_id":   ColumnInt,
+		"table_name": ColumnString,
+		"record_id":  ColumnInt,
+		"action":     ColumnEnum,
+		"before":     ColumnJSON,
+		"after":      ColumnJSON,
+		"created_at": ColumnTime,
+	},
+	"revision": {
+		"id":         ColumnInt,
+		"table_name": ColumnString,
+		"record_id":  ColumnInt,
+		"version":    ColumnInt,
+		"data":       ColumnJSON,
+		"actor_id":   ColumnInt,
+		"created_at": ColumnTime,
+	},
+}
+
+// HasColumn reports whether the column is registered for the table
+func HasColumn(table string, column string) bool {
+	_, ok := schema[table][column]
+	return ok
+}
+
+// ColumnTypeOf returns the type of a registered column of the table, and whether it is registered
+func ColumnTypeOf(table string, column string) (ColumnType, bool) {
+	columnType, ok := schema[table][column]
+	return columnType, ok
+}
+
+// quoteTable returns the quoted name of a registered table, or an error if it isn't registered
+func quoteTable(table string) (string, error) {
+	if _, ok := schema[table]; !ok {
+		return "", fmt.Errorf("unknown table %q", table)
+	}
+	return pq.QuoteIdentifier(table), nil
+}
+
+// quoteColumn returns the quoted name of a registered column of the table, or an error if it isn't registered
+func quoteColumn(table string, column string) (string, error) {
+	if !HasColumn(table, column) {
+		return "", fmt.Errorf("unknown column %q in table %q", column, table)
+	}
+	return pq.QuoteIdentifier(column), nil
+}
+
+// quoteColumns quotes each of the columns of the table, failing on the first one that isn't registered
+func quoteColumns(table string, columns []string) ([]string, error) {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		var err error
+		if quoted[i], err = quoteColumn(table, column); err != nil {
+			return nil, err
+		}
+	}
+	return quoted, nil
+}
+
+// convertValue converts a value scanned from a column of the table to the Go type of the column.
+// The driver returns text, enums and JSONB as bytes, so those are the values that change.
+func convertValue(table string, column string, value interface{}) interface{} {
+	raw, ok := value.([]byte)
+	if !ok {
+		return value
+	}
+
+	switch schema[table][column] {
+	case ColumnEnum:
+		translated := db.TranslateEnumValue(table, column, raw)
+		if _, ok := translated.([]byte); ok {
+			return string(raw)
+		}
+		return translated
+	case ColumnJSON:
+		return json.RawMessage(raw)
+	case ColumnString:
+		return string(raw)
+	}
+	return value
+}
@@ -0,0 +1,142 @@
+package crud
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/adolfooes/api_faker/internal/db"
+)
+
+// Tx runs the crud operations inside a database transaction, see WithTx
+type Tx struct {
+	tx      *sql.Tx
+	ctx     context.Context
+	changes changeSet
+}
+
+// WithTx runs fn in a transaction. The transaction is committed when fn returns nil
+// and rolled back when it returns an error or panics. It is also rolled back when ctx is cancelled.
+func WithTx(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	sqlTx, err := db.GetDB().BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			sqlTx.Rollback()
+			panic(p)
+		}
+	}()
+
+	t := &Tx{tx: sqlTx, ctx: ctx, changes: changeSet{}}
+	if err := fn(t); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+
+	if err := sqlTx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// The changed projects are only announced once their changes are visible to other connections
+	t.changes.publish()
+	return nil
+}
+
+// executor returns an executor running one operation inside the transaction, with its own query timeout
+func (t *Tx) executor() (executor, context.CancelFunc) {
+	return withContext(t.ctx, t.tx)
+}
+
+// Create inserts a new record like Create, inside the transaction
+func (t *Tx) Create(table string, columns []string, values []interface{}) (Row, error) {
+	q, cancel := t.executor()
+	defer cancel()
+	return createRecord(q, table, columns, values)
+}
+
+// Read retrieves a record like Read, inside the transaction
+func (t *Tx) Read(table string, id int64) (Row, error) {
+	q, cancel := t.executor()
+	defer cancel()
+	return readRecord(q, table, id)
+}
+
+// List retrieves records like List, inside the transaction
+func (t *Tx) List(table string, filters map[string]interface{}) ([]Row, error) {
+	q, cancel := t.executor()
+	defer cancel()
+	return listRecords(q, table, filters)
+}
+
+// Update updates a record like Update, inside the transaction
+func (t *Tx) Update(table string, id int64, updates map[string]interface{}) (Row, error) {
+	q, cancel := t.executor()
+	defer cancel()
+	return updateRecord(q, table, id, updates)
+}
+
+// Delete removes a record like Delete, inside the transaction
+func (t *Tx) Delete(table string, id int64) error {
+	q, cancel := t.executor()
+	defer cancel()
+	return deleteRecord(q, table, id)
+}
+
+// Raw executes any SQL command like Raw, inside the transaction
+func (t *Tx) Raw(query string, args ...interface{}) ([]Row, int64, error) {
+	q, cancel := t.executor()
+	defer cancel()
+	return rawQuery(q, query, args...)
+}
+
+// CreateAudited inserts a record like CreateAudited, inside the transaction
+func (t *Tx) CreateAudited(actorID int64, table string, columns []string, values []interface{}) (Row, error) {
+	q, cancel := t.executor()
+	defer cancel()
+	return createAudited(q, t.changes, actorID, table, columns, values)
+}
+
+// UpdateAudited updates a record like UpdateAudited, inside the transaction
+func (t *Tx) UpdateAudited(actorID int64, table string, id int64, updates map[string]interface{}) (Row, error) {
+	q, cancel := t.executor()
+	defer cancel()
+	return updateAudited(q, t.changes, actorID, table, id, updates)
+}
+
+// DeleteAudited removes a record like DeleteAudited, inside the transaction
+func (t *Tx) DeleteAudited(actorID int64, table string, id int64) error {
+	q, cancel := t.executor()
+	defer cancel()
+	return deleteAudited(q, t.changes, actorID, table, id)
+}
+
+// Lock takes a row lock on a record until the transaction ends. Writes that validate
+// the children of a record lock it first, so concurrent writes can't invalidate each other's checks.
+func (t *Tx) Lock(table string, id int64) error {
+	quotedTable, err := quoteTable(table)
+	if err != nil {
+		return err
+	}
+
+	q, cancel := t.executor()
+	defer cancel()
+
+	var lockedID int64
+	err = q.QueryRow(fmt.Sprintf("SELECT id FROM %s WHERE id = $1 FOR UPDATE", quotedTable), id).Scan(&lockedID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no record found with id %d", id)
+	}
+	if err != nil {
+		return fmt.Errorf("error locking record: %w", err)
+	}
+	return nil
+}
+
+// ProjectChanged records the change of a project made without the audited operations, e.g. by a cascading
+// delete, so it is announced to the OnProjectChange listeners with the others once the transaction is committed
+func (t *Tx) ProjectChanged(projectID int64) {
+	t.changes.add(projectID)
+}
@@ -0,0 +1,97 @@
+package jsondiff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Kinds of changes between two JSON documents
+const (
+	OpAdded   = "added"
+	OpRemoved = "removed"
+	OpChanged = "changed"
+)
+
+// Change describes one difference between two JSON documents, located by a JSON Pointer path
+type Change struct {
+	Path string      `json:"path"`
+	Op   string      `json:"op"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// Diff compares two decoded JSON documents (as produced by encoding/json) and lists their differences
+func Diff(from interface{}, to interface{}) []Change {
+	changes := []Change{}
+	diff("", from, to, &changes)
+	return changes
+}
+
+func diff(path string, from interface{}, to interface{}, changes *[]Change) {
+	switch fromValue := from.(type) {
+	case map[string]interface{}:
+		toValue, ok := to.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := map[string]bool{}
+		for key := range fromValue {
+			keys[key] = true
+		}
+		for key := range toValue {
+			keys[key] = true
+		}
+
+		sortedKeys := make([]string, 0, len(keys))
+		for key := range keys {
+			sortedKeys = append(sortedKeys, key)
+		}
+		sort.Strings(sortedKeys)
+
+		for _, key := range sortedKeys {
+			childPath := path + "/" + escapePointer(key)
+			fromChild, inFrom := fromValue[key]
+			toChild, inTo := toValue[key]
+			switch {
+			case !inFrom:
+				*changes = append(*changes, Change{Path: childPath, Op: OpAdded, To: toChild})
+			case !inTo:
+				*changes = append(*changes, Change{Path: childPath, Op: OpRemoved, From: fromChild})
+			default:
+				diff(childPath, fromChild, toChild, changes)
+			}
+		}
+		return
+
+	case []interface{}:
+		toValue, ok := to.([]interface{})
+		if !ok {
+			break
+		}
+
+		for i := 0; i < len(fromValue) || i < len(toValue); i++ {
+			childPath := fmt.Sprintf("%s/%d", path, i)
+			switch {
+			case i >= len(fromValue):
+				*changes = append(*changes, Change{Path: childPath, Op: OpAdded, To: toValue[i]})
+			case i >= len(toValue):
+				*changes = append(*changes, Change{Path: childPath, Op: OpRemoved, From: fromValue[i]})
+			default:
+				diff(childPath, fromValue[i], toValue[i], changes)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, Change{Path: path, Op: OpChanged, From: from, To: to})
+	}
+}
+
+// escapePointer escapes a key for use in a JSON Pointer (RFC 6901)
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,119 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/adolfooes/api_faker/config"
+)
+
+// Sender delivers plain-text emails
+type Sender interface {
+	Send(to string, subject string, body string) error
+}
+
+// SMTPSender sends emails through an SMTP server
+type SMTPSender struct {
+	Address  string
+	Username string
+	Password string
+	From     string
+}
+
+// FileSender writes every email to a file, useful for development and tests
+type FileSender struct {
+	Dir  string
+	From string
+}
+
+// LogSender writes every email to the application log
+type LogSender struct{}
+
+var defaultSender Sender = LogSender{}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._@-]`)
+
+// NewSender returns the sender for the given driver ("smtp", "file" or "log")
+func NewSender(driver string) (Sender, error) {
+	switch driver {
+	case "smtp":
+		username, password := config.GetSMTPCredentials()
+		return &SMTPSender{
+			Address:  config.GetSMTPAddress(),
+			Username: username,
+			Password: password,
+			From:     config.GetMailFrom(),
+		}, nil
+	case "file":
+		return &FileSender{Dir: config.GetMailFileDir(), From: config.GetMailFrom()}, nil
+	case "log":
+		return LogSender{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %s", driver)
+	}
+}
+
+// SetDefaultSender replaces the sender used by Send
+func SetDefaultSender(sender Sender) {
+	defaultSender = sender
+}
+
+// Send delivers an email using the default sender
+func Send(to string, subject string, body string) error {
+	return defaultSender.Send(to, subject, body)
+}
+
+// buildMessage formats an RFC 5322 plain-text message
+func buildMessage(from string, to string, subject string, body string) []byte {
+	var msg strings.Builder
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + subject + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(body)
+	return []byte(msg.String())
+}
+
+// Send delivers the email through the SMTP server
+func (s *SMTPSender) Send(to string, subject string, body string) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host := strings.Split(s.Address, ":")[0]
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	err := smtp.SendMail(s.Address, auth, s.From, []string{to}, buildMessage(s.From, to, subject, body))
+	if err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+	return nil
+}
+
+// Send writes the email to a new .eml file in the configured directory
+func (s *FileSender) Send(to string, subject string, body string) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return fmt.Errorf("error creating mail directory: %v", err)
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), unsafeFileChars.ReplaceAllString(to, "_"))
+	err := os.WriteFile(filepath.Join(s.Dir, name), buildMessage(s.From, to, subject, body), 0o644)
+	if err != nil {
+		return fmt.Errorf("error writing email: %v", err)
+	}
+	return nil
+}
+
+// Send logs the email instead of delivering it
+func (LogSender) Send(to string, subject string, body string) error {
+	log.Printf("Email to %s: %s\n%s", to, subject, body)
+	return nil
+}
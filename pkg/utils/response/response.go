@@ -3,6 +3,8 @@ package response
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/adolfooes/api_faker/config"
 )
 
 // Response is the common structure for all API responses.
@@ -10,6 +12,45 @@ type Response struct {
 	Message string      `json:"message"`
 	Stack   string      `json:"stack,omitempty"` // Stack can be omitted if empty
 	Data    interface{} `json:"data,omitempty"`  // Data can be omitted if nil
+	Page    *Page       `json:"page,omitempty"`  // Page is only set by list endpoints
+}
+
+// Page describes which slice of a list a response holds
+type Page struct {
+	Total   int64 `json:"total"`
+	Limit   int   `json:"limit"`
+	Offset  int   `json:"offset"`
+	HasMore bool  `json:"has_more"`
+}
+
+// ErrorDetailRecorder is implemented by response writers that log the internal error detail of a response
+type ErrorDetailRecorder interface {
+	RecordErrorDetail(detail string)
+}
+
+// recordErrorDetail hands the error detail to the first writer wrapped by w, or w itself, that records it
+func recordErrorDetail(w http.ResponseWriter, detail string) {
+	for {
+		if recorder, ok := w.(ErrorDetailRecorder); ok {
+			recorder.RecordErrorDetail(detail)
+			return
+		}
+		wrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = wrapper.Unwrap()
+	}
+}
+
+// jsonContentType is shared by every response instead of allocating the header value each time
+var jsonContentType = []string{"application/json"}
+
+// SendRaw sends a pre-serialized JSON body as it is, without encoding it. It is the fast path of mock responses.
+func SendRaw(w http.ResponseWriter, statusCode int, body []byte) {
+	w.Header()["Content-Type"] = jsonContentType
+	w.WriteHeader(statusCode)
+	w.Write(body)
 }
 
 // SendResponse is a helper function to send standardized API responses or mock responses
@@ -26,6 +67,9 @@ func SendResponse(w http.ResponseWriter, statusCode int, message string, stack s
 		case []byte:
 			// Write byte slice (in case the mock data is a raw JSON byte array)
 			w.Write(v)
+		case json.RawMessage:
+			// Write JSONB columns as they are stored
+			w.Write(v)
 		default:
 			// Assume it's a JSON object and encode it
 			if err := json.NewEncoder(w).Encode(data); err != nil {
@@ -35,11 +79,31 @@ func SendResponse(w http.ResponseWriter, statusCode int, message string, stack s
 		return
 	}
 
+	// The internal error detail is always logged, but only sent outside of production
+	if stack != "" {
+		recordErrorDetail(w, stack)
+		if config.IsProduction() {
+			stack = ""
+		}
+	}
+
 	// Send the structured response
 	response := Response{
 		Message: message,
-		Stack:   stack, // change to send only in development mode
+		Stack:   stack,
 		Data:    data,
 	}
 	json.NewEncoder(w).Encode(response)
 }
+
+// SendPage sends one page of a list, with the page metadata next to the data
+func SendPage(w http.ResponseWriter, message string, data interface{}, page Page) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	json.NewEncoder(w).Encode(Response{
+		Message: message,
+		Data:    data,
+		Page:    &page,
+	})
+}